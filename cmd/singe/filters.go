@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// loadFlags holds the rule selection flags shared by subcommands that load rules
+type loadFlags struct {
+	status        *string
+	excludeStatus *string
+	minLevel      *string
+	tags          *string
+	excludeTags   *string
+	product       *string
+	category      *string
+	ids           *string
+	excludeIDs    *string
+	paths         *string
+	excludePaths  *string
+	selection     *string
+	failOnError   *bool
+}
+
+// addLoadFlags registers the rule selection flags in a flag set
+func addLoadFlags(flags *flag.FlagSet) *loadFlags {
+	return &loadFlags{
+		status:        flags.String("status", "", "comma separated rule statuses to load"),
+		excludeStatus: flags.String("exclude-status", "", "comma separated rule statuses to skip, e.g. experimental,deprecated"),
+		minLevel:      flags.String("min-level", "", "lowest rule level to load"),
+		tags:          flags.String("tags", "", "comma separated tag globs of the rules to load, e.g. attack.t1003*"),
+		excludeTags:   flags.String("exclude-tags", "", "comma separated tag globs of the rules to skip"),
+		product:       flags.String("product", "", "logsource product of the rules to load"),
+		category:      flags.String("category", "", "logsource category of the rules to load"),
+		ids:           flags.String("ids", "", "comma separated IDs of the rules to load"),
+		excludeIDs:    flags.String("exclude-ids", "", "comma separated IDs of the rules to skip"),
+		paths:         flags.String("paths", "", "comma separated globs of rule file paths to load, relative to the rule directory"),
+		excludePaths:  flags.String("exclude-paths", "", "comma separated globs of rule file paths to skip"),
+		selection:     flags.String("selection", "", "YAML rule selection file"),
+		failOnError:   flags.Bool("fail-on-error", false, "fail when any rule file fails to load"),
+	}
+}
+
+// splitList returns the elements of a comma separated flag value
+func splitList(str string) []string {
+	var list []string
+	for _, elem := range strings.Split(str, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
+
+// options returns the load options of the flags
+func (l *loadFlags) options() ([]singe.LoadOption, error) {
+	opts := []singe.LoadOption{
+		singe.IncludeStatus(splitList(*l.status)...),
+		singe.ExcludeStatus(splitList(*l.excludeStatus)...),
+		singe.IncludeTags(splitList(*l.tags)...),
+		singe.ExcludeTags(splitList(*l.excludeTags)...),
+		singe.IncludeLogsource(*l.product, *l.category),
+		singe.IncludeIDs(splitList(*l.ids)...),
+		singe.ExcludeIDs(splitList(*l.excludeIDs)...),
+		singe.IncludePaths(splitList(*l.paths)...),
+		singe.ExcludePaths(splitList(*l.excludePaths)...),
+	}
+	if *l.minLevel != "" {
+		level := types.ToLevel(*l.minLevel)
+		if level == types.UnknownLevel {
+			return nil, fmt.Errorf("unknown level %q", *l.minLevel)
+		}
+		opts = append(opts, singe.MinLevel(level))
+	}
+	if *l.failOnError {
+		opts = append(opts, singe.FailOnError())
+	}
+	if *l.selection != "" {
+		selection, err := singe.LoadSelection(*l.selection)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, singe.SelectRules(selection))
+	}
+	return opts, nil
+}
+
+// isArchive returns whether a rules path is a rule pack archive rather than a directory
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// source returns the rule source of a directory or rule pack archive
+func source(path string) singe.RuleSource {
+	if isArchive(path) {
+		return singe.FromArchive(path)
+	}
+	return singe.FromDir(path)
+}
+
+// loadEngine loads the rules of a directory or rule pack archive with the selection of the flags
+func (l *loadFlags) loadEngine(path string) (singe.SigmaEngine, error) {
+	opts, err := l.options()
+	if err != nil {
+		return singe.SigmaEngine{}, err
+	}
+	return singe.NewEngineFrom(source(path), opts...)
+}
+
+// reloadableEngine loads the rules of a directory or rule pack archive with the selection of the flags into an
+// engine that can be reloaded, configuring each loaded engine with the configure argument
+func (l *loadFlags) reloadableEngine(path string, configure func(singe.SigmaEngine) singe.SigmaEngine) (*singe.ReloadableEngine, error) {
+	opts, err := l.options()
+	if err != nil {
+		return nil, err
+	}
+	return singe.NewReloadableEngine(source(path), configure, opts...)
+}
@@ -0,0 +1,59 @@
+// Command singe runs SIGMA rule tooling from the command line
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// errUsage is returned by a subcommand with invalid arguments once it printed its usage
+var errUsage = errors.New("invalid arguments")
+
+// command is a singe subcommand
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"navigator": {"export an ATT&CK Navigator layer of the loaded rule coverage", runNavigator},
+	"replay":    {"diff the events of a corpus matched by baseline and candidate rules", runReplay},
+	"scan":      {"match log files line by line against the loaded rules", runScan},
+	"test":      {"run the sample events of rules and report which rules pass", runTest},
+	"validate":  {"check rules against the Sigma specification", runValidate},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: singe <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	err := cmd.run(os.Args[2:])
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "singe %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
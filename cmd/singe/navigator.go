@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// runNavigator writes an ATT&CK Navigator layer for the rules in a directory
+func runNavigator(args []string) error {
+	flags := flag.NewFlagSet("navigator", flag.ExitOnError)
+	rules := flags.String("rules", "", "directory or archive of Sigma rules")
+	output := flags.String("out", "-", "layer output file, - for stdout")
+	name := flags.String("name", "", "layer name")
+	description := flags.String("description", "", "layer description")
+	matches := flags.String("matches", "", "JSON lines output of a previous run to score techniques by match count")
+	load := addLoadFlags(flags)
+	flags.Parse(args)
+
+	if *rules == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	opts := singe.NavigatorOptions{Name: *name, Description: *description}
+	if *matches != "" {
+		f, err := os.Open(*matches)
+		if err != nil {
+			return err
+		}
+		counts, err := singe.CountMatches(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		opts.MatchCounts = counts
+	}
+
+	engine, err := load.loadEngine(*rules)
+	if err != nil {
+		return err
+	}
+	layer := engine.NavigatorLayer(opts)
+
+	if *output == "-" {
+		return layer.Write(os.Stdout)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = layer.Write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	logrus "github.com/sirupsen/logrus"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	exceptions "github.com/Adversary-Informed-Defense/singe/pkg/singe/exceptions"
+)
+
+// runReplay replays a corpus of log files through the baseline and candidate rules and writes the match diff per rule
+func runReplay(args []string) (err error) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	baseline := flags.String("baseline", "", "directory or archive of the baseline Sigma rules")
+	rules := flags.String("rules", "", "directory or archive of the candidate Sigma rules")
+	baselineExceptions := flags.String("baseline-exceptions", "", "YAML rule exceptions of the baseline engine")
+	candidateExceptions := flags.String("exceptions", "", "YAML rule exceptions of the candidate engine")
+	vendor := flags.String("vendor", "json", "log vendor of the corpus files")
+	format := flags.String("format", "text", "output format: text or json")
+	examples := flags.Int("examples", singe.DefaultReplayExamples, "example events kept per rule for new and lost matches")
+	all := flags.Bool("all", false, "report unchanged rules as well as changed ones")
+	load := addLoadFlags(flags)
+	flags.Usage = func() {
+		flags.Output().Write([]byte("Usage: singe replay -baseline DIR -rules DIR [flags] FILE...\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *baseline == "" || *rules == "" || flags.NArg() == 0 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return errUsage
+	}
+	old, err := replayEngine(load, *baseline, *baselineExceptions)
+	if err != nil {
+		return err
+	}
+	candidate, err := replayEngine(load, *rules, *candidateExceptions)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Rules changed between baseline and candidate: %s", singe.DiffRules(old, candidate))
+
+	replayer := singe.NewReplayer(old, candidate, *examples)
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = replayer.Replay(path, f, *vendor)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	report := replayer.Report()
+	if !*all {
+		report.Rules = report.Changed()
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if flushErr := out.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	if *format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	fmt.Fprintf(out, "Replayed %d events, %d errors, %d rules changed\n", report.Events, report.Errors, len(report.Changed()))
+	for _, rule := range report.Rules {
+		fmt.Fprintln(out, rule)
+		for _, example := range rule.NewEvents {
+			fmt.Fprintf(out, "    + %s:%d %s\n", example.Source, example.Line, example.Event)
+		}
+		for _, example := range rule.LostEvents {
+			fmt.Fprintf(out, "    - %s:%d %s\n", example.Source, example.Line, example.Event)
+		}
+	}
+	return nil
+}
+
+// replayEngine loads the rules of one side of a replay with the shared selection flags and its own exceptions
+func replayEngine(load *loadFlags, path string, exceptionFile string) (singe.SigmaEngine, error) {
+	engine, err := load.loadEngine(path)
+	if err != nil || exceptionFile == "" {
+		return engine, err
+	}
+	set, err := exceptions.Load(exceptionFile)
+	if err != nil {
+		return engine, err
+	}
+	return engine.WithExceptions(set), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	exceptions "github.com/Adversary-Informed-Defense/singe/pkg/singe/exceptions"
+	sinks "github.com/Adversary-Informed-Defense/singe/pkg/singe/sinks"
+	suppress "github.com/Adversary-Informed-Defense/singe/pkg/singe/suppress"
+)
+
+// runScan matches the lines of log files against the rules in a directory
+func runScan(args []string) (err error) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	rules := flags.String("rules", "", "directory or archive of Sigma rules")
+	vendor := flags.String("vendor", "json", "log vendor of the scanned files")
+	format := flags.String("format", "json", "output format: json, ecs, ocsf, sarif or stix")
+	output := flags.String("out", "-", "output file, - for stdout")
+	sinkConfig := flags.String("sinks", "", "YAML sink configuration to route matches to instead of the output file")
+	suppressConfig := flags.String("suppress", "", "YAML suppression configuration of repeated matches")
+	exceptionFile := flags.String("exceptions", "", "YAML rule exceptions excluding matching events")
+	reload := flags.Duration("reload", 0, "interval at which the rules are checked for changes and reloaded while scanning, 0 to disable")
+	load := addLoadFlags(flags)
+	flags.Usage = func() {
+		flags.Output().Write([]byte("Usage: singe scan -rules DIR [flags] [FILE...]\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *rules == "" {
+		flags.Usage()
+		return errUsage
+	}
+	if *reload > 0 && (*format == "sarif" || *format == "stix") && *sinkConfig == "" {
+		return fmt.Errorf("-reload is not supported with the %s format", *format)
+	}
+	var set *exceptions.Set
+	if *exceptionFile != "" {
+		if set, err = exceptions.Load(*exceptionFile); err != nil {
+			return err
+		}
+		defer func() {
+			for _, report := range set.Report() {
+				logrus.Infof("Exception for rule %s suppressed %d events", report.Rule, report.Suppressed)
+			}
+		}()
+	}
+	configure := func(engine singe.SigmaEngine) singe.SigmaEngine {
+		if set != nil {
+			return engine.WithExceptions(set)
+		}
+		return engine
+	}
+	var engine singe.SigmaEngine
+	var scanner logScanner
+	var reloadable *singe.ReloadableEngine
+	if *reload > 0 {
+		if reloadable, err = load.reloadableEngine(*rules, configure); err != nil {
+			return err
+		}
+		engine, scanner = reloadable.Engine(), reloadable
+	} else {
+		loaded, err := load.loadEngine(*rules)
+		if err != nil {
+			return err
+		}
+		engine = configure(loaded)
+		scanner = engine
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = bufio.NewWriter(f)
+	}
+	defer func() {
+		if flushErr := out.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+
+	// Batch formats are written once all files are scanned
+	var finish func() error
+	var emit singe.ScanFunc
+	var path string
+	switch {
+	case *sinkConfig != "":
+		config, err := sinks.LoadConfig(*sinkConfig)
+		if err != nil {
+			return err
+		}
+		router, err := config.Build()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := router.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		// A failing destination must not stop the scan for the others
+		emit = func(line int, msg singe.OutputMessage) error {
+			if err := router.Write(msg); err != nil {
+				logrus.Infof("Error writing line %d to sinks: %s", line, err)
+			}
+			return nil
+		}
+	case *format == "sarif":
+		sarif := singe.NewSARIFWriter(engine)
+		emit = func(line int, msg singe.OutputMessage) error {
+			sarif.Add(path, line, msg)
+			return nil
+		}
+		finish = func() error { return sarif.Write(out) }
+	case *format == "stix":
+		stix, err := singe.NewSTIXWriter(engine)
+		if err != nil {
+			return err
+		}
+		emit = func(line int, msg singe.OutputMessage) error {
+			return stix.Add(msg, time.Now())
+		}
+		finish = func() error { return stix.Write(out) }
+	default:
+		f, err := singe.ParseFormat(*format)
+		if err != nil {
+			return err
+		}
+		emit = func(line int, msg singe.OutputMessage) error {
+			encoded, err := f.Encode(msg)
+			if err != nil {
+				return err
+			}
+			out.Write(encoded)
+			return out.WriteByte('\n')
+		}
+	}
+
+	var suppressor *suppress.Suppressor
+	if *suppressConfig != "" {
+		config, err := suppress.LoadConfig(*suppressConfig)
+		if err != nil {
+			return err
+		}
+		if suppressor, err = suppress.NewSuppressor(config, engine); err != nil {
+			return err
+		}
+		emit = suppressEmit(suppressor, emit, finish == nil)
+	}
+	if reloadable != nil {
+		reloadable.Watch(*reload, func(diff singe.RuleDiff, err error) {
+			if err != nil {
+				logrus.Errorf("Failed to reload sigma rules, keeping the previous rules: %s", err)
+				return
+			}
+			logrus.Infof("Reloaded sigma rules: %s", diff)
+			// Suppression attributes of added and changed rules apply from their reload
+			if suppressor == nil {
+				return
+			}
+			if err := suppressor.Reload(reloadable.Engine()); err != nil {
+				logrus.Errorf("Failed to reload suppression attributes, keeping the previous ones: %s", err)
+			}
+		})
+		defer reloadable.Close()
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, path = range files {
+		if err := scanFile(scanner, path, *vendor, emit); err != nil {
+			return err
+		}
+	}
+	if suppressor != nil && finish == nil {
+		for _, summary := range suppressor.Flush() {
+			if err := emit(0, summary.Message()); err != nil {
+				return err
+			}
+		}
+	}
+	if finish != nil {
+		return finish()
+	}
+	return nil
+}
+
+// suppressEmit wraps a scan function to drop suppressed matches
+// Summaries of closed windows are emitted as line 0 for streaming outputs, batch formats only count forwarded matches
+func suppressEmit(suppressor *suppress.Suppressor, emit singe.ScanFunc, summaries bool) singe.ScanFunc {
+	return func(line int, msg singe.OutputMessage) error {
+		now := time.Now()
+		for _, summary := range suppressor.Expire(now) {
+			if !summaries {
+				break
+			}
+			if err := emit(0, summary.Message()); err != nil {
+				return err
+			}
+		}
+		msg, ok := suppressor.Apply(msg, now)
+		if !ok {
+			return nil
+		}
+		return emit(line, msg)
+	}
+}
+
+// logScanner matches the lines of a log against rules, implemented by SigmaEngine and ReloadableEngine
+type logScanner interface {
+	Scan(r io.Reader, vendor string, fn singe.ScanFunc) error
+}
+
+// scanFile scans a single log file, or stdin for the path "-"
+func scanFile(engine logScanner, path string, vendor string, emit singe.ScanFunc) error {
+	if path == "-" {
+		return engine.Scan(os.Stdin, vendor, emit)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return engine.Scan(f, vendor, emit)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	ruletest "github.com/Adversary-Informed-Defense/singe/pkg/singe/ruletest"
+)
+
+// runTest evaluates the sample events of the rules in a directory and reports whether each rule passed
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	rules := flags.String("rules", "", "directory of Sigma rules and their samples")
+	junit := flags.String("junit", "", "JUnit XML report output file")
+	verbose := flags.Bool("v", false, "list passed samples and rules without samples")
+	load := addLoadFlags(flags)
+	flags.Parse(args)
+
+	if *rules == "" {
+		flags.Usage()
+		return errUsage
+	}
+	opts, err := load.options()
+	if err != nil {
+		return err
+	}
+	report, err := ruletest.Run(*rules, opts...)
+	if err != nil {
+		return err
+	}
+
+	samples := 0
+	for _, rule := range report.Rules {
+		samples += len(rule.Samples)
+		switch {
+		case rule.Err != nil:
+			fmt.Printf("FAIL %s: %s\n", rule.Path, rule.Err)
+			continue
+		case rule.Passed():
+			fmt.Printf("PASS %s (%d samples)\n", rule.Path, len(rule.Samples))
+		default:
+			fmt.Printf("FAIL %s (%d of %d samples failed)\n", rule.Path, rule.Failures(), len(rule.Samples))
+		}
+		for _, sample := range rule.Samples {
+			switch {
+			case sample.Skipped:
+				if *verbose {
+					fmt.Printf("    SKIP %s\n", sample.Name)
+				}
+			case sample.Passed:
+				if *verbose {
+					fmt.Printf("    PASS %s\n", sample.Name)
+				}
+			default:
+				fmt.Printf("    FAIL %s: %s\n", sample.Name, sample.Failure)
+			}
+		}
+	}
+	if *verbose {
+		for _, path := range report.Untested {
+			fmt.Printf("NONE %s\n", path)
+		}
+	}
+
+	if *junit != "" {
+		f, err := os.Create(*junit)
+		if err != nil {
+			return err
+		}
+		err = report.WriteJUnit(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if failures := report.Failures(); failures > 0 {
+		return fmt.Errorf("%d of %d tested rule files failed", failures, len(report.Rules))
+	}
+	fmt.Printf("%d rule files and %d samples passed, %d rule files without samples\n", len(report.Rules), samples, len(report.Untested))
+	return nil
+}
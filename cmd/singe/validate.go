@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	objx "github.com/stretchr/objx"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	validate "github.com/Adversary-Informed-Defense/singe/pkg/singe/validate"
+)
+
+// runValidate checks rule files against the Sigma specification and writes the findings
+func runValidate(args []string) (err error) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	format := flags.String("format", "json", "output format: json for one finding per line, or text")
+	mapping := flags.String("mapping", "", "JSON field mapping that the fields of the rules are checked against")
+	strict := flags.Bool("strict", false, "fail on warnings as well as errors")
+	flags.Usage = func() {
+		flags.Output().Write([]byte("Usage: singe validate [flags] PATH...\n\nPATH is a rule file, a directory or a rule pack archive\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 || (*format != "json" && *format != "text") {
+		flags.Usage()
+		return errUsage
+	}
+	var opts validate.Options
+	if *mapping != "" {
+		data, err := ioutil.ReadFile(*mapping)
+		if err != nil {
+			return err
+		}
+		if opts.Mapping, err = objx.FromJSON(string(data)); err != nil {
+			return fmt.Errorf("%s: %w", *mapping, err)
+		}
+	}
+
+	var files []tools.RuleFile
+	for _, path := range flags.Args() {
+		pathFiles, err := source(path)()
+		if err != nil {
+			return err
+		}
+		files = append(files, pathFiles...)
+	}
+	findings := validate.Validate(files, opts)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if flushErr := out.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	encoder := json.NewEncoder(out)
+	for _, finding := range findings {
+		if *format == "text" {
+			fmt.Fprintln(out, finding)
+			continue
+		}
+		if err := encoder.Encode(finding); err != nil {
+			return err
+		}
+	}
+
+	errors := validate.Errors(findings)
+	if errors > 0 || *strict && len(findings) > 0 {
+		return fmt.Errorf("%d errors and %d warnings in %d files", errors, len(findings)-errors, len(files))
+	}
+	return nil
+}
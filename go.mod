@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/markuskont/go-sigma-rule-engine v0.2.1
+	github.com/ryanuber/go-glob v1.0.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/objx v0.3.0
 	github.com/stretchr/testify v1.7.0
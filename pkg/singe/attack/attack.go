@@ -0,0 +1,194 @@
+package attack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TagPrefix is the namespace used by Sigma rules for MITRE ATT&CK tags
+const TagPrefix = "attack."
+
+// BaseURL is the root of the public MITRE ATT&CK knowledge base
+const BaseURL = "https://attack.mitre.org"
+
+// Kind represents the enumerated ATT&CK object types referenced by Sigma tags
+type Kind int64
+
+const (
+	Tactic Kind = iota
+	Technique
+	SubTechnique
+	Group
+	Software
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Tactic:
+		return "tactic"
+	case Technique:
+		return "technique"
+	case SubTechnique:
+		return "subtechnique"
+	case Group:
+		return "group"
+	case Software:
+		return "software"
+	}
+	return "Unreachable: unknown kind"
+}
+
+// MarshalText encodes the kind by name so that JSON output stays readable
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind from its name
+func (k *Kind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "tactic":
+		*k = Tactic
+	case "technique":
+		*k = Technique
+	case "subtechnique":
+		*k = SubTechnique
+	case "group":
+		*k = Group
+	case "software":
+		*k = Software
+	default:
+		return fmt.Errorf("unknown ATT&CK kind: %s", text)
+	}
+	return nil
+}
+
+// Tag is the structured form of a single Sigma ATT&CK tag
+type Tag struct {
+	Tag       string   `json:"tag"`
+	Kind      Kind     `json:"kind"`
+	ID        string   `json:"id"`
+	Technique string   `json:"technique,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Tactics   []string `json:"tactics,omitempty"`
+}
+
+// tacticInfo holds the static identifiers of an ATT&CK enterprise tactic
+type tacticInfo struct {
+	ID   string
+	Name string
+}
+
+// tacticName normalizes a Sigma tactic tag name to its key in tactics, since current rules write tactics hyphenated,
+// e.g. "defense-evasion", and older rules with underscores
+func tacticName(name string) string {
+	return strings.Replace(strings.ToLower(name), "-", "_", -1)
+}
+
+// tactics maps the Sigma tactic tag names to their ATT&CK identifiers
+var tactics = map[string]tacticInfo{
+	"reconnaissance":       {"TA0043", "Reconnaissance"},
+	"resource_development": {"TA0042", "Resource Development"},
+	"initial_access":       {"TA0001", "Initial Access"},
+	"execution":            {"TA0002", "Execution"},
+	"persistence":          {"TA0003", "Persistence"},
+	"privilege_escalation": {"TA0004", "Privilege Escalation"},
+	"defense_evasion":      {"TA0005", "Defense Evasion"},
+	"credential_access":    {"TA0006", "Credential Access"},
+	"discovery":            {"TA0007", "Discovery"},
+	"lateral_movement":     {"TA0008", "Lateral Movement"},
+	"collection":           {"TA0009", "Collection"},
+	"command_and_control":  {"TA0011", "Command and Control"},
+	"exfiltration":         {"TA0010", "Exfiltration"},
+	"impact":               {"TA0040", "Impact"},
+}
+
+var (
+	techniquePattern    = regexp.MustCompile(`^t(\d{4})$`)
+	subTechniquePattern = regexp.MustCompile(`^t(\d{4})\.(\d{3})$`)
+	groupPattern        = regexp.MustCompile(`^g(\d{4})$`)
+	softwarePattern     = regexp.MustCompile(`^s(\d{4})$`)
+)
+
+// ParseTag returns the structured form of a Sigma ATT&CK tag, if the tag references ATT&CK
+func ParseTag(tag string) (Tag, bool) {
+	lower := strings.ToLower(strings.TrimSpace(tag))
+	if !strings.HasPrefix(lower, TagPrefix) {
+		return Tag{}, false
+	}
+	value := strings.TrimPrefix(lower, TagPrefix)
+
+	name := tacticName(value)
+	if info, ok := tactics[name]; ok {
+		return Tag{
+			Tag:     tag,
+			Kind:    Tactic,
+			ID:      info.ID,
+			Name:    info.Name,
+			URL:     objectURL(Tactic, info.ID),
+			Tactics: []string{name},
+		}, true
+	}
+	if m := subTechniquePattern.FindStringSubmatch(value); m != nil {
+		id := "T" + m[1] + "." + m[2]
+		return Tag{
+			Tag:       tag,
+			Kind:      SubTechnique,
+			ID:        id,
+			Technique: "T" + m[1],
+			URL:       objectURL(SubTechnique, id),
+		}, true
+	}
+	if m := techniquePattern.FindStringSubmatch(value); m != nil {
+		id := "T" + m[1]
+		return Tag{Tag: tag, Kind: Technique, ID: id, URL: objectURL(Technique, id)}, true
+	}
+	if m := groupPattern.FindStringSubmatch(value); m != nil {
+		id := "G" + m[1]
+		return Tag{Tag: tag, Kind: Group, ID: id, URL: objectURL(Group, id)}, true
+	}
+	if m := softwarePattern.FindStringSubmatch(value); m != nil {
+		id := "S" + m[1]
+		return Tag{Tag: tag, Kind: Software, ID: id, URL: objectURL(Software, id)}, true
+	}
+	return Tag{}, false
+}
+
+// ParseTags returns the structured ATT&CK tags found in a Sigma tag list, skipping duplicates and non-ATT&CK tags
+func ParseTags(tags []string) []Tag {
+	var output []Tag
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		parsed, ok := ParseTag(tag)
+		if !ok || seen[parsed.ID] {
+			continue
+		}
+		seen[parsed.ID] = true
+		output = append(output, parsed)
+	}
+	return output
+}
+
+// TacticID returns the ATT&CK identifier of a Sigma tactic tag name such as "defense_evasion" or "defense-evasion"
+func TacticID(name string) (string, bool) {
+	info, ok := tactics[tacticName(name)]
+	return info.ID, ok
+}
+
+// objectURL returns the ATT&CK knowledge base page of an object
+func objectURL(kind Kind, id string) string {
+	switch kind {
+	case Tactic:
+		return fmt.Sprintf("%s/tactics/%s/", BaseURL, id)
+	case Technique:
+		return fmt.Sprintf("%s/techniques/%s/", BaseURL, id)
+	case SubTechnique:
+		return fmt.Sprintf("%s/techniques/%s/", BaseURL, strings.Replace(id, ".", "/", 1))
+	case Group:
+		return fmt.Sprintf("%s/groups/%s/", BaseURL, id)
+	case Software:
+		return fmt.Sprintf("%s/software/%s/", BaseURL, id)
+	}
+	return ""
+}
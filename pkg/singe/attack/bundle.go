@@ -0,0 +1,131 @@
+package attack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// stixBundle is the subset of a STIX 2.x bundle needed to resolve ATT&CK objects
+type stixBundle struct {
+	Type    string       `json:"type"`
+	Objects []stixObject `json:"objects"`
+}
+
+type stixObject struct {
+	Type               string              `json:"type"`
+	Name               string              `json:"name"`
+	ShortName          string              `json:"x_mitre_shortname"`
+	Revoked            bool                `json:"revoked"`
+	Deprecated         bool                `json:"x_mitre_deprecated"`
+	ExternalReferences []externalReference `json:"external_references"`
+	KillChainPhases    []killChainPhase    `json:"kill_chain_phases"`
+}
+
+type externalReference struct {
+	SourceName string `json:"source_name"`
+	ExternalID string `json:"external_id"`
+	URL        string `json:"url"`
+}
+
+type killChainPhase struct {
+	KillChainName string `json:"kill_chain_name"`
+	PhaseName     string `json:"phase_name"`
+}
+
+// entry is a resolved ATT&CK object from a bundle
+type entry struct {
+	Name    string
+	URL     string
+	Tactics []string
+}
+
+// Matrix holds the ATT&CK objects of a STIX bundle indexed by their ATT&CK ID
+type Matrix struct {
+	entries map[string]entry
+}
+
+// LoadBundle reads a locally supplied ATT&CK STIX bundle (e.g. enterprise-attack.json) from the file path
+func LoadBundle(path string) (*Matrix, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBundle(data)
+}
+
+// ParseBundle builds a Matrix from the bytes of an ATT&CK STIX bundle
+func ParseBundle(data []byte) (*Matrix, error) {
+	var bundle stixBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("not a STIX bundle: type %q", bundle.Type)
+	}
+
+	m := &Matrix{entries: make(map[string]entry)}
+	for _, obj := range bundle.Objects {
+		switch obj.Type {
+		case "attack-pattern", "x-mitre-tactic", "intrusion-set", "malware", "tool":
+		default:
+			continue
+		}
+		// Revoked and deprecated objects would shadow their current replacements
+		if obj.Revoked || obj.Deprecated {
+			continue
+		}
+		for _, ref := range obj.ExternalReferences {
+			if ref.SourceName != "mitre-attack" || ref.ExternalID == "" {
+				continue
+			}
+			e := entry{Name: obj.Name, URL: ref.URL}
+			for _, phase := range obj.KillChainPhases {
+				if phase.KillChainName == "mitre-attack" {
+					e.Tactics = append(e.Tactics, strings.Replace(phase.PhaseName, "-", "_", -1))
+				}
+			}
+			m.entries[strings.ToUpper(ref.ExternalID)] = e
+		}
+	}
+	return m, nil
+}
+
+// Len returns the number of ATT&CK objects in the matrix
+func (m *Matrix) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.entries)
+}
+
+// Lookup returns the name and URL of an ATT&CK object by ID
+func (m *Matrix) Lookup(id string) (name string, url string, ok bool) {
+	if m == nil {
+		return "", "", false
+	}
+	e, ok := m.entries[strings.ToUpper(id)]
+	return e.Name, e.URL, ok
+}
+
+// Enrich returns a copy of the tags with names, URLs and tactics taken from the matrix
+func (m *Matrix) Enrich(tags []Tag) []Tag {
+	if m == nil || len(tags) == 0 {
+		return tags
+	}
+	output := make([]Tag, len(tags))
+	for i, tag := range tags {
+		if e, ok := m.entries[tag.ID]; ok {
+			tag.Name = e.Name
+			if e.URL != "" {
+				tag.URL = e.URL
+			}
+			if tag.Kind != Tactic && len(e.Tactics) > 0 {
+				tag.Tactics = e.Tactics
+			}
+		}
+		output[i] = tag
+	}
+	return output
+}
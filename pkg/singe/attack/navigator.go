@@ -0,0 +1,94 @@
+package attack
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Versions of the ATT&CK Navigator layer format written by this package
+const (
+	NavigatorVersion = "4.9.1"
+	LayerVersion     = "4.5"
+	AttackVersion    = "14"
+	EnterpriseDomain = "enterprise-attack"
+)
+
+// Layer is an ATT&CK Navigator layer document
+type Layer struct {
+	Name        string           `json:"name"`
+	Versions    LayerVersions    `json:"versions"`
+	Domain      string           `json:"domain"`
+	Description string           `json:"description"`
+	Techniques  []LayerTechnique `json:"techniques"`
+	Gradient    LayerGradient    `json:"gradient"`
+	Legend      []LayerLegend    `json:"legendItems"`
+	Metadata    []LayerMetadata  `json:"metadata,omitempty"`
+
+	HideDisabled            bool `json:"hideDisabled"`
+	ShowTacticRowBackground bool `json:"showTacticRowBackground"`
+}
+
+// LayerVersions records the ATT&CK, Navigator and layer format versions of a layer
+type LayerVersions struct {
+	Attack    string `json:"attack"`
+	Navigator string `json:"navigator"`
+	Layer     string `json:"layer"`
+}
+
+// LayerTechnique is the score and annotations of a single technique in a layer
+type LayerTechnique struct {
+	TechniqueID       string          `json:"techniqueID"`
+	Tactic            string          `json:"tactic,omitempty"`
+	Score             float64         `json:"score"`
+	Comment           string          `json:"comment,omitempty"`
+	Enabled           bool            `json:"enabled"`
+	Metadata          []LayerMetadata `json:"metadata,omitempty"`
+	ShowSubtechniques bool            `json:"showSubtechniques"`
+}
+
+// LayerGradient is the color scale applied to technique scores
+type LayerGradient struct {
+	Colors   []string `json:"colors"`
+	MinValue float64  `json:"minValue"`
+	MaxValue float64  `json:"maxValue"`
+}
+
+// LayerLegend is a single legend entry of a layer
+type LayerLegend struct {
+	Label string `json:"label"`
+	Color string `json:"color"`
+}
+
+// LayerMetadata is a name/value annotation on a layer or technique
+type LayerMetadata struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewLayer returns an empty enterprise layer with the default gradient
+func NewLayer(name string, description string) Layer {
+	return Layer{
+		Name: name,
+		Versions: LayerVersions{
+			Attack:    AttackVersion,
+			Navigator: NavigatorVersion,
+			Layer:     LayerVersion,
+		},
+		Domain:      EnterpriseDomain,
+		Description: description,
+		Techniques:  []LayerTechnique{},
+		Gradient: LayerGradient{
+			Colors:   []string{"#ffffff", "#66b1ff", "#ff6666"},
+			MinValue: 0,
+			MaxValue: 1,
+		},
+		Legend: []LayerLegend{},
+	}
+}
+
+// Write encodes the layer as indented JSON
+func (l Layer) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(l)
+}
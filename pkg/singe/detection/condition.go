@@ -0,0 +1,233 @@
+package detection
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	glob "github.com/ryanuber/go-glob"
+)
+
+// conditionTokens splits a condition into parentheses, pipes and words
+var conditionTokens = regexp.MustCompile(`[()|]|[^\s()|]+`)
+
+// NewTree builds the tree of a Sigma rule from its detection, in place of sigma.NewTree whose selections support
+// neither value modifiers beyond contains, startswith and endswith nor fields written with modifiers
+func NewTree(rule sigma.RuleHandle) (*sigma.Tree, error) {
+	root, err := NewBranch(rule.Detection)
+	if err != nil {
+		return nil, err
+	}
+	return &sigma.Tree{Root: root, Rule: &rule}, nil
+}
+
+// NewBranch builds the branch of a Sigma detection from its condition, either a string or a list of strings joined by
+// logical disjunction
+// Aggregations are reported as sigma.ErrUnsupportedToken and undefined identifiers as sigma.ErrMissingConditionItem
+func NewBranch(detection sigma.Detection) (sigma.Branch, error) {
+	if detection == nil {
+		return nil, sigma.ErrMissingDetection{}
+	}
+	var conditions []string
+	switch c := detection["condition"].(type) {
+	case string:
+		conditions = []string{c}
+	case []interface{}:
+		for _, elem := range c {
+			str, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("condition %v is not a string", elem)
+			}
+			conditions = append(conditions, str)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, sigma.ErrMissingCondition{}
+	}
+
+	p := &conditionParser{detection: detection, branches: make(map[string]sigma.Branch)}
+	or := make(sigma.NodeSimpleOr, 0, len(conditions))
+	for _, condition := range conditions {
+		branch, err := p.parse(condition)
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, branch)
+	}
+	return or.Reduce(), nil
+}
+
+// conditionParser is a recursive descent parser of the conditions of a detection, binding "not" tighter than "and"
+// and "and" tighter than "or"
+type conditionParser struct {
+	detection sigma.Detection
+	tokens    []string
+	pos       int
+	// branches caches the branches of the identifiers built so far
+	branches map[string]sigma.Branch
+}
+
+// parse returns the branch of a single condition
+func (p *conditionParser) parse(condition string) (sigma.Branch, error) {
+	p.tokens, p.pos = conditionTokens.FindAllString(condition, -1), 0
+	if len(p.tokens) == 0 {
+		return nil, sigma.ErrMissingCondition{}
+	}
+	for _, token := range p.tokens {
+		if token == "|" {
+			return nil, sigma.ErrUnsupportedToken{Msg: fmt.Sprintf("aggregation not supported [%s]", condition)}
+		}
+	}
+	branch, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in condition %q", p.tokens[p.pos], condition)
+	}
+	return branch, nil
+}
+
+// peek returns the next token without consuming it, or an empty string at the end of the condition
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// next consumes the next token, returning an empty string at the end of the condition
+func (p *conditionParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.pos++
+	}
+	return token
+}
+
+// or parses terms joined by "or"
+func (p *conditionParser) or() (sigma.Branch, error) {
+	var or sigma.NodeSimpleOr
+	for {
+		branch, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, branch)
+		if !strings.EqualFold(p.peek(), "or") {
+			return or.Reduce(), nil
+		}
+		p.next()
+	}
+}
+
+// and parses factors joined by "and"
+func (p *conditionParser) and() (sigma.Branch, error) {
+	var and sigma.NodeSimpleAnd
+	for {
+		branch, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, branch)
+		if !strings.EqualFold(p.peek(), "and") {
+			return and.Reduce(), nil
+		}
+		p.next()
+	}
+}
+
+// not parses a factor that may be negated
+func (p *conditionParser) not() (sigma.Branch, error) {
+	if !strings.EqualFold(p.peek(), "not") {
+		return p.primary()
+	}
+	p.next()
+	branch, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	return &sigma.NodeNot{B: branch}, nil
+}
+
+// primary parses a parenthesized condition, a quantified identifier pattern such as "1 of selection_*", or an identifier
+func (p *conditionParser) primary() (sigma.Branch, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case token == "(":
+		branch, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return branch, nil
+	case token == ")":
+		return nil, fmt.Errorf("unexpected closing parenthesis")
+	case strings.EqualFold(p.peek(), "of"):
+		p.next()
+		return p.quantified(token, p.next())
+	}
+	return p.identifier(token)
+}
+
+// quantified returns the branch of "1 of" or "all of" an identifier pattern, where "them" is every identifier not
+// starting with an underscore
+func (p *conditionParser) quantified(quantifier string, pattern string) (sigma.Branch, error) {
+	var names []string
+	for name := range p.detection {
+		if name == "condition" || name == "timeframe" {
+			continue
+		}
+		if strings.EqualFold(pattern, "them") && !strings.HasPrefix(name, "_") || glob.Glob(pattern, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, sigma.ErrMissingConditionItem{Key: pattern}
+	}
+	sort.Strings(names)
+	branches := make([]sigma.Branch, len(names))
+	for i, name := range names {
+		branch, err := p.identifier(name)
+		if err != nil {
+			return nil, err
+		}
+		branches[i] = branch
+	}
+	switch strings.ToLower(quantifier) {
+	case "1", "any":
+		return sigma.NodeSimpleOr(branches).Reduce(), nil
+	case "all":
+		return sigma.NodeSimpleAnd(branches).Reduce(), nil
+	}
+	return nil, fmt.Errorf("unknown quantifier %q of %s", quantifier, pattern)
+}
+
+// identifier returns the branch of a detection identifier, building it on first use
+func (p *conditionParser) identifier(name string) (sigma.Branch, error) {
+	if branch, ok := p.branches[name]; ok {
+		return branch, nil
+	}
+	val, ok := p.detection[name]
+	if !ok || name == "condition" || name == "timeframe" {
+		return nil, sigma.ErrMissingConditionItem{Key: name}
+	}
+	var branch sigma.Branch
+	var err error
+	if isSelection(val) {
+		branch, err = NewSelection(val)
+	} else {
+		branch, err = NewKeywords(val)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	p.branches[name] = branch
+	return branch, nil
+}
@@ -0,0 +1,478 @@
+package detection
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+)
+
+// matchMode represents the enumerated ways a selection value matches a field value
+type matchMode int64
+
+const (
+	exactMode matchMode = iota
+	containsMode
+	startsWithMode
+	endsWithMode
+	regexMode
+	cidrMode
+	ltMode
+	lteMode
+	gtMode
+	gteMode
+)
+
+// textual returns whether the mode matches the text of values, so that values may be encoded before they are matched
+func (m matchMode) textual() bool {
+	return m <= endsWithMode
+}
+
+// modes are the modifiers that set the match mode of a value
+var modes = map[string]matchMode{
+	"contains":   containsMode,
+	"startswith": startsWithMode,
+	"endswith":   endsWithMode,
+	"re":         regexMode,
+	"cidr":       cidrMode,
+	"lt":         ltMode,
+	"lte":        lteMode,
+	"gt":         gtMode,
+	"gte":        gteMode,
+}
+
+// transform returns the variants of a value that are matched in its place, e.g. its base64 encodings
+type transform func(value string) []string
+
+// transforms are the modifiers that encode values, applied in the order they are written
+var transforms = map[string]transform{
+	"base64":       encodeBase64,
+	"base64offset": base64Offsets,
+	"utf16le":      encodeUTF16LE,
+	"wide":         encodeUTF16LE,
+	"utf16be":      encodeUTF16BE,
+	"utf16":        encodeUTF16,
+}
+
+// modifiers holds the value modifiers of a selection key
+type modifiers struct {
+	mode  matchMode
+	all   bool
+	cased bool
+	// exists matches whether the field is present rather than its value
+	exists bool
+	// fieldref makes values name the event fields whose values are matched
+	fieldref bool
+	// windash makes the flag prefixes of values match any character that Windows programs accept as one
+	windash    bool
+	transforms []transform
+	// flags are the i, m and s flags of a regular expression
+	flags string
+}
+
+// parseModifiers parses the modifiers following the field name of a selection key
+// Modifiers that are not implemented are reported as sigma.ErrUnsupportedToken
+func parseModifiers(names []string) (modifiers, error) {
+	var mods modifiers
+	modeSet := false
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if mode, ok := modes[name]; ok {
+			if modeSet {
+				return mods, fmt.Errorf("modifier %s conflicts with a previous modifier", name)
+			}
+			mods.mode, modeSet = mode, true
+			continue
+		}
+		if t, ok := transforms[name]; ok {
+			mods.transforms = append(mods.transforms, t)
+			continue
+		}
+		switch name {
+		case "all":
+			mods.all = true
+		case "cased":
+			mods.cased = true
+		case "exists":
+			mods.exists = true
+		case "fieldref":
+			mods.fieldref = true
+		case "windash":
+			mods.windash = true
+		case "i", "m", "s":
+			mods.flags += name
+		default:
+			return mods, sigma.ErrUnsupportedToken{Msg: fmt.Sprintf("modifier %s", name)}
+		}
+	}
+	if mods.flags != "" && mods.mode != regexMode {
+		return mods, fmt.Errorf("regular expression flags %s without the re modifier", mods.flags)
+	}
+	if !mods.mode.textual() && (len(mods.transforms) > 0 || mods.windash) {
+		return mods, fmt.Errorf("value encoding modifiers cannot be combined with re, cidr or numeric comparisons")
+	}
+	if mods.fieldref && (len(mods.transforms) > 0 || mods.windash || mods.mode == regexMode || mods.mode == cidrMode) {
+		return mods, fmt.Errorf("modifier fieldref cannot be combined with value encoding, re or cidr modifiers")
+	}
+	// Flag characters are matched as a character class, which cannot be encoded
+	if mods.windash && len(mods.transforms) > 0 {
+		return mods, sigma.ErrUnsupportedToken{Msg: "modifier windash combined with value encoding modifiers"}
+	}
+	if mods.exists && len(names) > 1 {
+		return mods, fmt.Errorf("modifier exists cannot be combined with other modifiers")
+	}
+	// Encoded values are matched byte for byte: base64 is case sensitive and folding the case of UTF-16 bytes that are
+	// not valid UTF-8 would replace them all by the same character
+	mods.cased = mods.cased || len(mods.transforms) > 0
+	return mods, nil
+}
+
+// matcher builds the matcher of a selection value with the modifiers
+func (m modifiers) matcher(value interface{}) (valueMatcher, error) {
+	if value == nil {
+		if m.mode != exactMode || len(m.transforms) > 0 || m.windash {
+			return nil, fmt.Errorf("null value cannot have modifiers")
+		}
+		return nullMatcher{}, nil
+	}
+	str, ok := scalarString(value)
+	if !ok {
+		return nil, fmt.Errorf("value %v is not a string, number or boolean", value)
+	}
+	switch m.mode {
+	case ltMode, lteMode, gtMode, gteMode:
+		n, ok := toNumber(value)
+		if !ok {
+			return nil, fmt.Errorf("value %v is not a number", value)
+		}
+		return numericMatcher{mode: m.mode, value: n}, nil
+	case regexMode:
+		flags := ""
+		if m.flags != "" {
+			flags = "(?" + m.flags + ")"
+		}
+		re, err := regexp.Compile(flags + str)
+		if err != nil {
+			// Lookarounds and backreferences are valid Sigma regular expressions that RE2 does not implement
+			var syntaxErr *syntax.Error
+			if errors.As(err, &syntaxErr) && (syntaxErr.Code == syntax.ErrInvalidPerlOp || syntaxErr.Code == syntax.ErrInvalidNamedCapture ||
+				syntaxErr.Code == syntax.ErrInvalidEscape) {
+				return nil, sigma.ErrUnsupportedToken{Msg: err.Error()}
+			}
+			return nil, err
+		}
+		return regexMatcher{re: re}, nil
+	case cidrMode:
+		_, network, err := net.ParseCIDR(str)
+		if err != nil {
+			return nil, err
+		}
+		return cidrMatcher{network: network}, nil
+	}
+
+	variants := []string{str}
+	for _, t := range m.transforms {
+		var next []string
+		for _, variant := range variants {
+			next = append(next, t(variant)...)
+		}
+		variants = next
+	}
+	patterns := make(patternMatcher, len(variants))
+	for i, variant := range variants {
+		// Encoded values are bytes rather than text, so they are matched literally without wildcards
+		if len(m.transforms) > 0 {
+			patterns[i] = newLiteralPattern(variant, m.mode, m.cased)
+			continue
+		}
+		if m.windash {
+			patterns[i] = newWindashPattern(variant, m.mode, m.cased)
+			continue
+		}
+		patterns[i] = newStringPattern(variant, m.mode, m.cased)
+	}
+	return patterns, nil
+}
+
+// fieldRef is a selection value of the fieldref modifier, naming the event field whose value is matched
+type fieldRef struct {
+	field string
+	mode  matchMode
+	cased bool
+}
+
+// resolve returns the matcher of the referenced field's value in an event, which never matches if the referenced
+// field is missing or does not hold a string, number or boolean
+// The referenced value is matched literally, its wildcard characters are not expanded
+func (f fieldRef) resolve(e sigma.Event) valueMatcher {
+	val, ok := selectField(e, f.field)
+	if !ok {
+		return patternMatcher{}
+	}
+	if !f.mode.textual() {
+		number, ok := toNumber(val)
+		if !ok {
+			return patternMatcher{}
+		}
+		return numericMatcher{mode: f.mode, value: number}
+	}
+	str, ok := scalarString(val)
+	if !ok {
+		return patternMatcher{}
+	}
+	return patternMatcher{newLiteralPattern(str, f.mode, f.cased)}
+}
+
+// valueMatcher matches a field value against a selection value
+type valueMatcher interface {
+	match(val interface{}) bool
+}
+
+// patternMatcher matches string, number and boolean field values against any of the variants of a selection value
+type patternMatcher []stringPattern
+
+func (p patternMatcher) match(val interface{}) bool {
+	str, ok := scalarString(val)
+	if !ok {
+		return false
+	}
+	for _, pattern := range p {
+		if pattern.match(str) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexMatcher matches field values against a regular expression, which is not anchored
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (r regexMatcher) match(val interface{}) bool {
+	str, ok := scalarString(val)
+	return ok && r.re.MatchString(str)
+}
+
+// cidrMatcher matches field values that are IP addresses within a network
+type cidrMatcher struct {
+	network *net.IPNet
+}
+
+func (c cidrMatcher) match(val interface{}) bool {
+	str, ok := val.(string)
+	if !ok {
+		return false
+	}
+	ip := net.ParseIP(strings.TrimSpace(str))
+	return ip != nil && c.network.Contains(ip)
+}
+
+// nullMatcher matches null field values, which include missing fields
+type nullMatcher struct{}
+
+func (nullMatcher) match(val interface{}) bool {
+	return val == nil
+}
+
+// numericMatcher compares numbers and numeric strings with a number
+type numericMatcher struct {
+	mode  matchMode
+	value float64
+}
+
+func (n numericMatcher) match(val interface{}) bool {
+	number, ok := toNumber(val)
+	if !ok {
+		return false
+	}
+	switch n.mode {
+	case ltMode:
+		return number < n.value
+	case lteMode:
+		return number <= n.value
+	case gtMode:
+		return number > n.value
+	case gteMode:
+		return number >= n.value
+	}
+	return false
+}
+
+// toNumber returns the number of a numeric value or of a string holding a number, such as a JSON number or "3389"
+func toNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// stringPattern matches strings against a Sigma value, where * matches any characters, ? a single character and a
+// backslash escapes a following wildcard or backslash
+// Matching ignores case unless the pattern is cased
+type stringPattern struct {
+	mode  matchMode
+	cased bool
+	// token is the literal value of a pattern without wildcards, lowercase unless cased
+	token string
+	// re matches the values with wildcards
+	re *regexp.Regexp
+}
+
+// newStringPattern returns the pattern of a value matched whole, or as a substring, prefix or suffix by the mode
+func newStringPattern(value string, mode matchMode, cased bool) stringPattern {
+	return compilePattern(value, mode, cased, nil)
+}
+
+// newWindashPattern returns the pattern of a value whose command line flag prefixes match any of windashChars
+func newWindashPattern(value string, mode matchMode, cased bool) stringPattern {
+	dashes := make(map[int]bool)
+	for _, loc := range windashPattern.FindAllStringIndex(value, -1) {
+		dashes[utf8.RuneCountInString(value[:loc[0]])] = true
+	}
+	return compilePattern(value, mode, cased, dashes)
+}
+
+// compilePattern returns the pattern of a value, where the runes at the indexes set in dashes match any of windashChars
+func compilePattern(value string, mode matchMode, cased bool, dashes map[int]bool) stringPattern {
+	var literal, expr strings.Builder
+	wildcards := false
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case dashes[i]:
+			wildcards = true
+			expr.WriteString(windashClass)
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\'):
+			i++
+			literal.WriteRune(runes[i])
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '*':
+			wildcards = true
+			expr.WriteString(".*")
+		case r == '?':
+			wildcards = true
+			expr.WriteString(".")
+		default:
+			literal.WriteRune(r)
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if !wildcards {
+		return newLiteralPattern(literal.String(), mode, cased)
+	}
+	prefix, suffix := "^", "$"
+	if mode == containsMode || mode == endsWithMode {
+		prefix = ""
+	}
+	if mode == containsMode || mode == startsWithMode {
+		suffix = ""
+	}
+	flags := "(?s)"
+	if !cased {
+		flags = "(?is)"
+	}
+	return stringPattern{mode: mode, cased: cased, re: regexp.MustCompile(flags + prefix + expr.String() + suffix)}
+}
+
+// newLiteralPattern returns the pattern of a value without wildcards
+func newLiteralPattern(value string, mode matchMode, cased bool) stringPattern {
+	if !cased {
+		value = strings.ToLower(value)
+	}
+	return stringPattern{mode: mode, cased: cased, token: value}
+}
+
+func (p stringPattern) match(str string) bool {
+	if p.re != nil {
+		return p.re.MatchString(str)
+	}
+	if !p.cased {
+		str = strings.ToLower(str)
+	}
+	switch p.mode {
+	case containsMode:
+		return strings.Contains(str, p.token)
+	case startsWithMode:
+		return strings.HasPrefix(str, p.token)
+	case endsWithMode:
+		return strings.HasSuffix(str, p.token)
+	}
+	return str == p.token
+}
+
+// encodeBase64 returns the base64 encoding of a value
+func encodeBase64(value string) []string {
+	return []string{base64.StdEncoding.EncodeToString([]byte(value))}
+}
+
+// base64Offsets returns the three base64 encodings of a value at each offset within a longer encoded string, without
+// the leading and trailing characters that depend on the surrounding bytes
+func base64Offsets(value string) []string {
+	starts := [3]int{0, 2, 3}
+	ends := [3]int{0, 3, 2}
+	var variants []string
+	for i := 0; i < 3; i++ {
+		encoded := base64.StdEncoding.EncodeToString([]byte(strings.Repeat(" ", i) + value))
+		end := len(encoded) - ends[(len(value)+i)%3]
+		if starts[i] < end {
+			variants = append(variants, encoded[starts[i]:end])
+		}
+	}
+	return variants
+}
+
+// encodeUTF16LE returns the UTF-16 little-endian encoding of a value, as written by Windows command lines
+func encodeUTF16LE(value string) []string {
+	return []string{utf16String(value, binary.LittleEndian)}
+}
+
+// encodeUTF16BE returns the UTF-16 big-endian encoding of a value
+func encodeUTF16BE(value string) []string {
+	return []string{utf16String(value, binary.BigEndian)}
+}
+
+// encodeUTF16 returns the UTF-16 little-endian encoding of a value preceded by its byte order mark
+func encodeUTF16(value string) []string {
+	return []string{"\xff\xfe" + utf16String(value, binary.LittleEndian)}
+}
+
+// utf16String returns the UTF-16 encoding of a value in the byte order argument
+func utf16String(value string, order binary.ByteOrder) string {
+	units := utf16.Encode([]rune(value))
+	buf := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(buf[2*i:], unit)
+	}
+	return string(buf)
+}
+
+var (
+	// windashPattern matches the dashes and slashes that start command line flags
+	windashPattern = regexp.MustCompile(`\B[-/]\b`)
+	// windashChars are the characters that Windows programs accept as flag prefixes
+	windashChars = []string{"-", "/", "–", "—", "―"}
+	// windashClass is the regular expression character class of windashChars
+	windashClass = "[" + regexp.QuoteMeta(strings.Join(windashChars, "")) + "]"
+)
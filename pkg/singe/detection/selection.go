@@ -0,0 +1,283 @@
+package detection
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+)
+
+// isSelection returns whether a detection identifier is a field selection, a map or a list of maps, rather than keywords
+func isSelection(val interface{}) bool {
+	switch v := val.(type) {
+	case map[interface{}]interface{}, map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, elem := range v {
+			switch elem.(type) {
+			case map[interface{}]interface{}, map[string]interface{}:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectable returns whether an event has fields, plain log lines are only matched by keywords
+func selectable(e sigma.Event) bool {
+	_, keywords := e.Keywords()
+	return !keywords
+}
+
+// NewSelection builds the branch of a field selection, either a map of field conditions joined by logical conjunction
+// or a list of such maps joined by logical disjunction
+// Field keys are a field name followed by its value modifiers, e.g. "CommandLine|contains|all"
+func NewSelection(val interface{}) (sigma.Branch, error) {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = elem
+		}
+		return newSelection(m)
+	case map[string]interface{}:
+		return newSelection(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("empty selection list")
+		}
+		or := make(sigma.NodeSimpleOr, len(v))
+		for i, elem := range v {
+			if !isSelection(elem) {
+				return nil, fmt.Errorf("selection list element %v is not a map", elem)
+			}
+			branch, err := NewSelection(elem)
+			if err != nil {
+				return nil, err
+			}
+			or[i] = branch
+		}
+		return or.Reduce(), nil
+	}
+	return nil, fmt.Errorf("selection %v is not a map or a list of maps", val)
+}
+
+// selection matches events whose fields match every condition
+// A missing field only matches null values, so that negated selections match events without the field
+type selection []fieldCondition
+
+// Match implements sigma.Matcher
+func (s selection) Match(e sigma.Event) (bool, bool) {
+	if !selectable(e) {
+		return false, false
+	}
+	for _, condition := range s {
+		if !condition.match(e) {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// newSelection builds the conditions of a selection map, sorted by key
+func newSelection(m map[string]interface{}) (sigma.Branch, error) {
+	if len(m) == 0 {
+		return nil, fmt.Errorf("empty selection")
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s := make(selection, len(keys))
+	for i, key := range keys {
+		condition, err := newFieldCondition(key, m[key])
+		if err != nil {
+			return nil, err
+		}
+		s[i] = condition
+	}
+	return s, nil
+}
+
+// fieldCondition matches the value of an event field against the values of a selection key
+type fieldCondition struct {
+	field    string
+	matchers []valueMatcher
+	// all requires every value to match rather than any of them
+	all bool
+	// exists is set by the exists modifier to whether the field must be present, the condition has no matchers then
+	exists *bool
+	// refs are set by the fieldref modifier to the referenced fields, resolved to matchers for each event in place of
+	// the matchers of values
+	refs []fieldRef
+}
+
+// newFieldCondition parses a selection key and builds the matchers of its values, a single value or a list of them
+func newFieldCondition(key string, val interface{}) (fieldCondition, error) {
+	parts := strings.Split(key, "|")
+	condition := fieldCondition{field: parts[0]}
+	mods, err := parseModifiers(parts[1:])
+	if err != nil {
+		return condition, fmt.Errorf("%s: %w", key, err)
+	}
+	condition.all = mods.all
+	if mods.exists {
+		exists, ok := val.(bool)
+		if !ok {
+			return condition, fmt.Errorf("%s: value %v is not a boolean", key, val)
+		}
+		condition.exists = &exists
+		return condition, nil
+	}
+
+	values, ok := val.([]interface{})
+	if !ok {
+		values = []interface{}{val}
+	}
+	if len(values) == 0 {
+		return condition, fmt.Errorf("%s: empty value list", key)
+	}
+	for _, value := range values {
+		if mods.fieldref {
+			field, ok := value.(string)
+			if !ok || field == "" {
+				return condition, fmt.Errorf("%s: referenced field %v is not a field name", key, value)
+			}
+			condition.refs = append(condition.refs, fieldRef{field: field, mode: mods.mode, cased: mods.cased})
+			continue
+		}
+		matcher, err := mods.matcher(value)
+		if err != nil {
+			return condition, fmt.Errorf("%s: %w", key, err)
+		}
+		condition.matchers = append(condition.matchers, matcher)
+	}
+	return condition, nil
+}
+
+// match returns whether the event field matches any value of the condition, or every value with the all modifier
+// Fields holding a list match if any element matches, and missing fields are matched as null
+func (c fieldCondition) match(e sigma.Event) bool {
+	val, ok := selectField(e, c.field)
+	if c.exists != nil {
+		return ok == *c.exists
+	}
+	if !ok {
+		val = nil
+	}
+	matchers := c.matchers
+	if len(c.refs) > 0 {
+		matchers = make([]valueMatcher, len(c.refs))
+		for i, ref := range c.refs {
+			matchers[i] = ref.resolve(e)
+		}
+	}
+	for _, matcher := range matchers {
+		matched := matchElements(matcher, val)
+		if matched && !c.all {
+			return true
+		}
+		if !matched && c.all {
+			return false
+		}
+	}
+	return c.all
+}
+
+// selectField returns the value of an event field
+// Fields of JSON events are looked up by their dotted path without sigma.GetField, which panics on fields holding an
+// object, so that the existence of objects can be checked
+func selectField(e sigma.Event, field string) (interface{}, bool) {
+	if m, ok := e.(sigma.DynamicMap); ok {
+		return lookupField(m, field)
+	}
+	return e.Select(field)
+}
+
+// lookupField returns the value at the dotted path of a field, preferring keys that contain the dots themselves
+func lookupField(m map[string]interface{}, field string) (interface{}, bool) {
+	if val, ok := m[field]; ok {
+		return val, true
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if nested, ok := m[parts[0]].(map[string]interface{}); ok && len(parts) == 2 {
+		return lookupField(nested, parts[1])
+	}
+	return nil, false
+}
+
+// matchElements matches a field value, or any element of a list value
+func matchElements(matcher valueMatcher, val interface{}) bool {
+	list, ok := val.([]interface{})
+	if !ok {
+		return matcher.match(val)
+	}
+	for _, elem := range list {
+		if matcher.match(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewKeywords builds the branch of keywords, a string or a list of strings that are searched for in the keywords of
+// events such as plain log lines, ignoring case
+func NewKeywords(val interface{}) (sigma.Branch, error) {
+	values, ok := val.([]interface{})
+	if !ok {
+		values = []interface{}{val}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty keyword list")
+	}
+	k := make(keywords, len(values))
+	for i, value := range values {
+		str, ok := scalarString(value)
+		if !ok {
+			return nil, fmt.Errorf("keyword %v is not a string", value)
+		}
+		k[i] = newStringPattern(str, containsMode, false)
+	}
+	return k, nil
+}
+
+// keywords matches events with any keyword containing any of its patterns
+type keywords []stringPattern
+
+// Match implements sigma.Matcher
+func (k keywords) Match(e sigma.Event) (bool, bool) {
+	msgs, ok := e.Keywords()
+	if !ok {
+		return false, false
+	}
+	for _, msg := range msgs {
+		for _, pattern := range k {
+			if pattern.match(msg) {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
+
+// scalarString returns the string form of a string, number or boolean value
+func scalarString(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
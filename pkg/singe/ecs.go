@@ -0,0 +1,218 @@
+package singe
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// ECSVersion is the Elastic Common Schema version of encoded alerts
+const ECSVersion = "8.11.0"
+
+type ecsRule struct {
+	ID          string   `json:"id,omitempty"`
+	UUID        string   `json:"uuid,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Author      []string `json:"author,omitempty"`
+	Reference   string   `json:"reference,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	Ruleset     string   `json:"ruleset"`
+}
+
+type ecsThreatRef struct {
+	ID        []string `json:"id"`
+	Name      []string `json:"name,omitempty"`
+	Reference []string `json:"reference"`
+}
+
+type ecsTechnique struct {
+	ecsThreatRef
+	Subtechnique *ecsThreatRef `json:"subtechnique,omitempty"`
+}
+
+type ecsThreat struct {
+	Framework string        `json:"framework"`
+	Tactic    *ecsThreatRef `json:"tactic,omitempty"`
+	Technique *ecsTechnique `json:"technique,omitempty"`
+	Group     *ecsThreatRef `json:"group,omitempty"`
+	Software  *ecsThreatRef `json:"software,omitempty"`
+}
+
+// add appends an ATT&CK object to the reference lists
+func (r *ecsThreatRef) add(id string, name string, url string) {
+	for _, existing := range r.ID {
+		if existing == id {
+			return
+		}
+	}
+	r.ID = append(r.ID, id)
+	r.Name = append(r.Name, name)
+	r.Reference = append(r.Reference, url)
+}
+
+// compact drops the name list when no object was resolved to a name
+func (r *ecsThreatRef) compact() {
+	if r == nil {
+		return
+	}
+	for _, name := range r.Name {
+		if name != "" {
+			return
+		}
+	}
+	r.Name = nil
+}
+
+// ecsSeverity maps Sigma levels to the severity scores used by Elastic detection alerts
+func ecsSeverity(level types.Level) int {
+	switch level {
+	case types.InformationalLevel:
+		return 1
+	case types.LowLevel:
+		return 21
+	case types.MediumLevel:
+		return 47
+	case types.HighLevel:
+		return 73
+	case types.CriticalLevel:
+		return 99
+	}
+	return 0
+}
+
+// newECSThreat returns the ECS threat fields of the ATT&CK tags of a rule
+func newECSThreat(tags []attack.Tag) *ecsThreat {
+	if len(tags) == 0 {
+		return nil
+	}
+	threat := &ecsThreat{Framework: "MITRE ATT&CK"}
+	for _, tag := range tags {
+		switch tag.Kind {
+		case attack.Tactic:
+			if threat.Tactic == nil {
+				threat.Tactic = &ecsThreatRef{}
+			}
+			threat.Tactic.add(tag.ID, tag.Name, tag.URL)
+		case attack.Technique, attack.SubTechnique:
+			if threat.Technique == nil {
+				threat.Technique = &ecsTechnique{}
+			}
+			if tag.Kind == attack.Technique {
+				threat.Technique.add(tag.ID, tag.Name, tag.URL)
+				continue
+			}
+			// ECS expects the parent technique of every sub-technique
+			parent, _ := attack.ParseTag(attack.TagPrefix + tag.Technique)
+			threat.Technique.add(parent.ID, "", parent.URL)
+			if threat.Technique.Subtechnique == nil {
+				threat.Technique.Subtechnique = &ecsThreatRef{}
+			}
+			threat.Technique.Subtechnique.add(tag.ID, tag.Name, tag.URL)
+		case attack.Group:
+			if threat.Group == nil {
+				threat.Group = &ecsThreatRef{}
+			}
+			threat.Group.add(tag.ID, tag.Name, tag.URL)
+		case attack.Software:
+			if threat.Software == nil {
+				threat.Software = &ecsThreatRef{}
+			}
+			threat.Software.add(tag.ID, tag.Name, tag.URL)
+		}
+	}
+	threat.Tactic.compact()
+	if threat.Technique != nil {
+		threat.Technique.compact()
+		threat.Technique.Subtechnique.compact()
+	}
+	threat.Group.compact()
+	threat.Software.compact()
+	return threat
+}
+
+// newECSAlert returns the ECS alert document of a single matching rule
+func newECSAlert(event sigma.Event, original string, rule RuleData, now time.Time) map[string]interface{} {
+	doc := make(map[string]interface{})
+	ecsEvent := make(map[string]interface{})
+
+	// Structured events keep their own fields, so ECS-shaped sources stay in place
+	if fields, ok := event.(sigma.DynamicMap); ok {
+		for key, val := range fields {
+			doc[key] = val
+		}
+		if existing, ok := fields["event"].(map[string]interface{}); ok {
+			for key, val := range existing {
+				ecsEvent[key] = val
+			}
+		}
+	} else {
+		doc["message"] = original
+	}
+	if _, ok := doc["@timestamp"]; !ok {
+		doc["@timestamp"] = now.Format(time.RFC3339Nano)
+	}
+
+	ecsEvent["kind"] = "alert"
+	ecsEvent["severity"] = ecsSeverity(types.ToLevel(rule.Level))
+	ecsEvent["original"] = original
+	ecsEvent["created"] = now.Format(time.RFC3339Nano)
+	doc["event"] = ecsEvent
+
+	ecsRuleFields := ecsRule{
+		ID:          rule.ID,
+		UUID:        rule.ID,
+		Name:        rule.Title,
+		Description: rule.Description,
+		Ruleset:     "sigma",
+	}
+	for _, author := range strings.Split(rule.Author, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			ecsRuleFields.Author = append(ecsRuleFields.Author, author)
+		}
+	}
+	if len(rule.References) > 0 {
+		ecsRuleFields.Reference = rule.References[0]
+	}
+	if rule.Logsource != nil {
+		ecsRuleFields.Category = rule.Logsource.Category
+	}
+	doc["rule"] = ecsRuleFields
+
+	if threat := newECSThreat(rule.Attack); threat != nil {
+		doc["threat"] = threat
+	}
+	if len(rule.Tags) > 0 {
+		doc["tags"] = rule.Tags
+	}
+	doc["ecs"] = map[string]interface{}{"version": ECSVersion}
+	return doc
+}
+
+// encodeECS returns one newline delimited ECS alert document per matching rule of the output message
+func encodeECS(msg OutputMessage) ([]byte, error) {
+	original, err := msg.original()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	var buf bytes.Buffer
+	for i, rule := range msg.Result.MatchList {
+		doc, err := json.Marshal(newECSAlert(msg.Event, original, rule.RuleData, now))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(doc)
+	}
+	return buf.Bytes(), nil
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 
 	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	logrus "github.com/sirupsen/logrus"
 	objx "github.com/stretchr/objx"
 
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	exceptions "github.com/Adversary-Informed-Defense/singe/pkg/singe/exceptions"
 	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
 	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
 )
@@ -52,59 +55,164 @@ func toLogType(str string) LogType {
 
 type SigmaEngine struct {
 	ruleset *sigma.Ruleset
+	report  tools.LoadReport
+	matrix  *attack.Matrix
+	format  Format
+}
+
+// NewEngine returns a SigmaEngine with the ruleset defined by the Sigma rules in the directory at the path argument
+// Load options restrict the ruleset to the selected rules
+// An error is returned if the directory cannot be read, and with the FailOnError option if any rule file fails to load
+func NewEngine(path string, opts ...LoadOption) (SigmaEngine, error) {
+	return newEngine(FromDir(path), newLoadConfig(opts))
+}
+
+// NewEngineFrom returns a SigmaEngine with the ruleset defined by the Sigma rules of the source argument
+// An error is returned if the source cannot be listed, and with the FailOnError option if any rule file fails to load
+func NewEngineFrom(source RuleSource, opts ...LoadOption) (SigmaEngine, error) {
+	return newEngine(source, newLoadConfig(opts))
 }
 
 // CreateEngine returns a SigmaEngine struct instance with the ruleset defined by the Sigma rules in the directory at the path argument
-func CreateEngine(path string) SigmaEngine {
-	ruleset := tools.LoadRules(path)
-	return SigmaEngine{ruleset}
+// It is kept for compatibility: errors, including the load errors of the FailOnError option, are logged and the engine
+// of the rules that loaded is returned; NewEngine returns them instead
+func CreateEngine(path string, opts ...LoadOption) SigmaEngine {
+	engine, err := NewEngine(path, opts...)
+	if err != nil {
+		logrus.Errorf("Failed to load sigma rules: %s", err)
+	}
+	return engine
+}
+
+// newEngine loads the rules of the source argument with the load configuration
+func newEngine(source RuleSource, config loadConfig) (SigmaEngine, error) {
+	files, err := source()
+	if err != nil {
+		return SigmaEngine{ruleset: &sigma.Ruleset{}}, err
+	}
+	ruleset, report := tools.LoadRuleFiles(files, config.filter)
+	engine := SigmaEngine{ruleset: ruleset, report: report}
+	if config.failOnError {
+		if err := report.Err(); err != nil {
+			return engine, err
+		}
+	}
+	return engine, nil
+}
+
+// LoadReport returns the outcome of loading each rule file of the engine
+func (s SigmaEngine) LoadReport() tools.LoadReport {
+	return s.report
+}
+
+// RuleFile returns the content of the loaded rule file at the path argument, the Path of its rule handle
+// Custom rule attributes, which the Sigma rule type drops, can be read from it whatever the rule source
+func (s SigmaEngine) RuleFile(path string) ([]byte, bool) {
+	return s.report.File(path)
+}
+
+// RuleDocument returns the YAML of the loaded rule with the ID argument, see LoadReport.Document
+// Unlike RuleFile, it holds only the rule's own document for rules of a multi-document collection
+func (s SigmaEngine) RuleDocument(id string) ([]byte, bool) {
+	return s.report.Document(id)
+}
+
+// WithAttack returns a copy of the engine that enriches ATT&CK tags in match results using the matrix argument
+func (s SigmaEngine) WithAttack(matrix *attack.Matrix) SigmaEngine {
+	s.matrix = matrix
+	return s
+}
+
+// WithExceptions returns a copy of the engine whose rules exclude the events matched by their exceptions in the set argument
+// The engine's ruleset is left unchanged; suppression counts are reported by the set
+func (s SigmaEngine) WithExceptions(set *exceptions.Set) SigmaEngine {
+	if s.ruleset == nil {
+		return s
+	}
+	ruleset := *s.ruleset
+	ruleset.Rules = set.Apply(s.ruleset.Rules)
+	s.ruleset = &ruleset
+	return s
+}
+
+// WithFormat returns a copy of the engine that encodes match results returned by Match in the format argument
+func (s SigmaEngine) WithFormat(format Format) SigmaEngine {
+	s.format = format
+	return s
+}
+
+// Rules returns the Sigma rules loaded in the engine's ruleset
+func (s SigmaEngine) Rules() []*sigma.RuleHandle {
+	if s.ruleset == nil {
+		return nil
+	}
+	rules := make([]*sigma.RuleHandle, 0, len(s.ruleset.Rules))
+	for _, tree := range s.ruleset.Rules {
+		if tree.Rule != nil {
+			rules = append(rules, tree.Rule)
+		}
+	}
+	return rules
 }
 
 // Match evaluates a log message against a Sigma ruleset, returning whether at least one match occurred and the list of matching rules, if any
+// The matching rules are encoded in the engine's output format, JSON unless set by WithFormat
 func (s SigmaEngine) Match(msg string, vendor string) ([]byte, bool, error) {
+	result, matched, err := s.Evaluate(msg, vendor)
+	if err != nil || !matched {
+		return nil, matched, err
+	}
+	output, err := s.format.Encode(result)
+	if err != nil {
+		return nil, false, err
+	}
+	return output, true, nil
+}
+
+// Evaluate evaluates a log message against a Sigma ruleset, returning the unencoded output message of the matching rules, if any
+func (s SigmaEngine) Evaluate(msg string, vendor string) (OutputMessage, bool, error) {
 	// Map vendor string to LogType
 	lType := mapVendor(vendor)
 	// Cast log file to appropriate Sigma Event type
 	event, err := castEvent(msg, lType)
 	if err != nil {
-		return nil, false, err
+		return OutputMessage{}, false, err
 	}
+	if s.ruleset == nil {
+		return OutputMessage{}, false, nil
+	}
+
+	var rules []Rule
+
 	// Match event against Sigma rules
-	if results, matched := s.ruleset.EvalAll(event); matched {
-		outputResult := EngineResult{
-			Count: len(results),
+	for _, tree := range s.ruleset.Rules {
+		if !tree.Match(event) || tree.Rule == nil {
+			continue
 		}
-		var allTags []string
-		var allIDs []string
-
 		// Parse Sigma rule match data
-		for _, res := range results {
-			allTags = append(allTags, res.Tags...)
-			allIDs = append(allIDs, res.ID)
-
-			rule := Rule{
-				RuleData{
-					ID:    res.ID,
-					Title: res.Title,
-					Tags:  res.Tags,
-				},
-			}
-			outputResult.MatchList = append(outputResult.MatchList, rule)
-		}
-
-		// Remove repeated tags
-		outputResult.TagList = tools.RemoveStringDuplicates(allTags)
-
-		// Should not be possible to see duplicate IDs
-		outputResult.IDList = allIDs
+		rules = append(rules, Rule{s.ruleData(tree.Rule)})
+	}
+	if len(rules) == 0 {
+		return OutputMessage{}, false, nil
+	}
+	return newOutputMessage(event, msg, rules), true, nil
+}
 
-		output, err := json.Marshal(OutputMessage{event, outputResult})
-		if err != nil {
-			return nil, false, err
-		}
-		return output, true, nil
+// ruleData returns the match metadata of a Sigma rule
+func (s SigmaEngine) ruleData(rule *sigma.RuleHandle) RuleData {
+	logsource := rule.Logsource
+	return RuleData{
+		ID:          rule.ID,
+		Title:       rule.Title,
+		Tags:        rule.Tags,
+		Attack:      s.matrix.Enrich(attack.ParseTags(rule.Tags)),
+		Level:       rule.Level,
+		Status:      rule.Status,
+		Description: rule.Description,
+		Author:      rule.Author,
+		References:  rule.References,
+		Logsource:   &logsource,
 	}
-	return nil, false, nil
 }
 
 // mapVendor returns the enumerated log type mapped from the vendor string
@@ -0,0 +1,167 @@
+package exceptions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	logrus "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	detection "github.com/Adversary-Informed-Defense/singe/pkg/singe/detection"
+)
+
+// Exception excludes the events matched by its filter from the matches of a rule
+type Exception struct {
+	// suppressed counts the events matched by the rule that the filter excluded, first for 64-bit alignment
+	suppressed uint64
+
+	// Rule is the ID of the excepted rule
+	Rule        string `yaml:"rule"`
+	Description string `yaml:"description"`
+	// Filter is a Sigma selection, either a map of field conditions or a list of them
+	Filter interface{} `yaml:"filter"`
+
+	branch sigma.Branch
+}
+
+// Suppressed returns the number of events matched by the rule that the exception excluded
+func (e *Exception) Suppressed() uint64 {
+	return atomic.LoadUint64(&e.suppressed)
+}
+
+// compile parses the exception's filter into a Sigma branch
+func (e *Exception) compile() error {
+	if e.Rule == "" {
+		return fmt.Errorf("missing rule")
+	}
+	if e.Filter == nil {
+		return fmt.Errorf("missing filter")
+	}
+	branch, err := detection.NewSelection(e.Filter)
+	if err != nil {
+		return err
+	}
+	e.branch = branch
+	return nil
+}
+
+// Set holds the exceptions of an exception file, e.g.
+//
+//	exceptions:
+//	  - rule: e28a5a99-da44-436d-b7a0-2afc20a5f413
+//	    description: Login scripts of the jump hosts
+//	    filter:
+//	      host.name:
+//	        - JUMP01
+//	        - JUMP02
+//	  - rule: ca2092a1-c273-4878-9b4b-0d60115bf5ea
+//	    filter:
+//	      User: svc_backup
+//	      ParentImage: 'C:\Program Files\Backup\agent.exe'
+type Set struct {
+	Exceptions []*Exception `yaml:"exceptions"`
+
+	byRule map[string][]*Exception
+}
+
+// Load reads and compiles the exceptions of the YAML file at the path argument
+func Load(path string) (*Set, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// Parse compiles the exceptions of a YAML document
+func Parse(data []byte) (*Set, error) {
+	var set Set
+	if err := yaml.UnmarshalStrict(data, &set); err != nil {
+		return nil, err
+	}
+	set.byRule = make(map[string][]*Exception)
+	for i, exception := range set.Exceptions {
+		if err := exception.compile(); err != nil {
+			return nil, fmt.Errorf("exception %d: %w", i, err)
+		}
+		set.byRule[exception.Rule] = append(set.byRule[exception.Rule], exception)
+	}
+	return &set, nil
+}
+
+// Apply returns the trees argument with the condition of each excepted rule combined as "and not" with its exceptions' filters
+// The trees argument is left unchanged
+func (s *Set) Apply(trees []*sigma.Tree) []*sigma.Tree {
+	if s == nil {
+		return trees
+	}
+	applied := make(map[string]bool)
+	out := make([]*sigma.Tree, 0, len(trees))
+	for _, tree := range trees {
+		if tree.Rule == nil || len(s.byRule[tree.Rule.ID]) == 0 {
+			out = append(out, tree)
+			continue
+		}
+		applied[tree.Rule.ID] = true
+		out = append(out, &sigma.Tree{
+			Root: exceptedBranch{rule: tree.Root, exceptions: s.byRule[tree.Rule.ID]},
+			Rule: tree.Rule,
+		})
+	}
+	for id := range s.byRule {
+		if !applied[id] {
+			logrus.Infof("Exceptions for rule %s match no loaded rule", id)
+		}
+	}
+	return out
+}
+
+// Report summarizes how many events an exception excluded
+type Report struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Suppressed  uint64 `json:"suppressed"`
+}
+
+// Report returns the number of events excluded by each exception, in file order
+func (s *Set) Report() []Report {
+	if s == nil {
+		return nil
+	}
+	reports := make([]Report, len(s.Exceptions))
+	for i, exception := range s.Exceptions {
+		reports[i] = Report{
+			Rule:        exception.Rule,
+			Description: exception.Description,
+			Suppressed:  exception.Suppressed(),
+		}
+	}
+	return reports
+}
+
+// exceptedBranch matches the events matched by a rule and by none of its exceptions
+type exceptedBranch struct {
+	rule       sigma.Branch
+	exceptions []*Exception
+}
+
+// Match implements sigma.Matcher
+func (b exceptedBranch) Match(e sigma.Event) (bool, bool) {
+	match, applicable := b.rule.Match(e)
+	if !match || !applicable {
+		return match, applicable
+	}
+	for _, exception := range b.exceptions {
+		if excluded, ok := exception.branch.Match(e); excluded && ok {
+			atomic.AddUint64(&exception.suppressed, 1)
+			return false, true
+		}
+	}
+	return true, true
+}
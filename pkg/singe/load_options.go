@@ -0,0 +1,108 @@
+package singe
+
+import (
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// loadConfig holds the settings of LoadOptions
+type loadConfig struct {
+	filter      tools.RuleFilter
+	failOnError bool
+}
+
+// LoadOption configures the loading of the Sigma rules of an engine
+// Selection options of the same kind accumulate, e.g. two IncludeStatus options select the statuses of both
+type LoadOption func(*loadConfig)
+
+// newLoadConfig returns the load configuration of the options argument
+func newLoadConfig(opts []LoadOption) loadConfig {
+	var config loadConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// FailOnError fails engine creation when any rule file fails to load, instead of skipping it
+// Unsupported and filtered rules are still skipped
+func FailOnError() LoadOption {
+	return func(c *loadConfig) {
+		c.failOnError = true
+	}
+}
+
+// IncludeStatus loads only the rules with one of the status arguments, e.g. "stable" and "test"
+func IncludeStatus(statuses ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.Statuses = append(c.filter.Statuses, statuses...)
+	}
+}
+
+// ExcludeStatus skips the rules with one of the status arguments, e.g. "experimental" and "deprecated"
+func ExcludeStatus(statuses ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.ExcludeStatuses = append(c.filter.ExcludeStatuses, statuses...)
+	}
+}
+
+// MinLevel loads only the rules with a level of at least the level argument
+func MinLevel(level types.Level) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.MinLevel = level
+	}
+}
+
+// IncludeTags loads only the rules with a tag matching one of the glob arguments, e.g. "attack.t1003*"
+func IncludeTags(globs ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.Tags = append(c.filter.Tags, globs...)
+	}
+}
+
+// ExcludeTags skips the rules with a tag matching one of the glob arguments
+func ExcludeTags(globs ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.ExcludeTags = append(c.filter.ExcludeTags, globs...)
+	}
+}
+
+// IncludeLogsource loads only the rules of the logsource product and category arguments; an empty argument selects any value
+func IncludeLogsource(product string, category string) LoadOption {
+	return func(c *loadConfig) {
+		if product != "" {
+			c.filter.Products = append(c.filter.Products, product)
+		}
+		if category != "" {
+			c.filter.Categories = append(c.filter.Categories, category)
+		}
+	}
+}
+
+// IncludeIDs loads only the rules with one of the ID arguments
+func IncludeIDs(ids ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.IDs = append(c.filter.IDs, ids...)
+	}
+}
+
+// ExcludeIDs skips the rules with one of the ID arguments
+func ExcludeIDs(ids ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.ExcludeIDs = append(c.filter.ExcludeIDs, ids...)
+	}
+}
+
+// IncludePaths loads only the rule files whose path relative to the rule directory matches one of the glob arguments
+func IncludePaths(globs ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.Paths = append(c.filter.Paths, globs...)
+	}
+}
+
+// ExcludePaths skips the rule files whose path relative to the rule directory matches one of the glob arguments
+func ExcludePaths(globs ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.ExcludePaths = append(c.filter.ExcludePaths, globs...)
+	}
+}
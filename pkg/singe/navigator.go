@@ -0,0 +1,151 @@
+package singe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// NavigatorOptions configures the ATT&CK Navigator layer built from a loaded ruleset
+type NavigatorOptions struct {
+	Name        string
+	Description string
+	// MatchCounts holds the number of matches per rule ID from a previous run
+	// When set, techniques are scored by matches instead of by rule coverage
+	MatchCounts map[string]int
+}
+
+// techniqueCoverage accumulates the rules tagged with a single technique
+type techniqueCoverage struct {
+	id      string
+	rules   []string
+	levels  map[types.Level]int
+	weight  float64
+	matches int
+}
+
+// levelWeights are the coverage scores contributed by one rule of each level, rules without a level counting least
+var levelWeights = map[types.Level]float64{
+	types.UnknownLevel:       0.5,
+	types.InformationalLevel: 1,
+	types.LowLevel:           2,
+	types.MediumLevel:        3,
+	types.HighLevel:          4,
+	types.CriticalLevel:      5,
+}
+
+// NavigatorLayer returns an ATT&CK Navigator layer of the techniques covered by the engine's loaded ruleset
+func (s SigmaEngine) NavigatorLayer(opts NavigatorOptions) attack.Layer {
+	name := opts.Name
+	if name == "" {
+		name = "singe rule coverage"
+	}
+	layer := attack.NewLayer(name, opts.Description)
+
+	coverage := make(map[string]*techniqueCoverage)
+	if s.ruleset != nil {
+		for _, tree := range s.ruleset.Rules {
+			if tree.Rule == nil {
+				continue
+			}
+			level := types.ToLevel(tree.Rule.Level)
+			for _, tag := range attack.ParseTags(tree.Rule.Tags) {
+				if tag.Kind != attack.Technique && tag.Kind != attack.SubTechnique {
+					continue
+				}
+				c, ok := coverage[tag.ID]
+				if !ok {
+					c = &techniqueCoverage{id: tag.ID, levels: make(map[types.Level]int)}
+					coverage[tag.ID] = c
+				}
+				c.rules = append(c.rules, tree.Rule.Title)
+				c.levels[level]++
+				c.weight += levelWeights[level]
+				c.matches += opts.MatchCounts[tree.Rule.ID]
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(coverage))
+	for id := range coverage {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var maxScore float64
+	for _, id := range ids {
+		c := coverage[id]
+		score := c.weight
+		if opts.MatchCounts != nil {
+			score = float64(c.matches)
+		}
+		if score > maxScore {
+			maxScore = score
+		}
+		technique := attack.LayerTechnique{
+			TechniqueID: c.id,
+			Score:       score,
+			Comment:     strings.Join(c.rules, "; "),
+			Enabled:     true,
+			Metadata: []attack.LayerMetadata{
+				{Name: "rules", Value: strconv.Itoa(len(c.rules))},
+				{Name: "levels", Value: formatLevels(c.levels)},
+			},
+		}
+		if opts.MatchCounts != nil {
+			technique.Metadata = append(technique.Metadata, attack.LayerMetadata{Name: "matches", Value: strconv.Itoa(c.matches)})
+		}
+		layer.Techniques = append(layer.Techniques, technique)
+	}
+	if maxScore > 0 {
+		layer.Gradient.MaxValue = maxScore
+	}
+	return layer
+}
+
+// formatLevels returns a summary such as "high: 2, medium: 1" ordered by decreasing severity
+func formatLevels(levels map[types.Level]int) string {
+	var parts []string
+	for l := types.CriticalLevel; l >= types.UnknownLevel; l-- {
+		if n := levels[l]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", l, n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CountMatches returns the number of matches per rule ID from the JSON lines output of a previous run
+// Other output formats, such as ECS and OCSF, are rejected as they do not hold the sigma result of each match
+func CountMatches(r io.Reader) (map[string]int, error) {
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg struct {
+			Result *EngineResult `json:"sigma"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if msg.Result == nil {
+			return nil, fmt.Errorf("line %d: not a match of the json output format", lineNum)
+		}
+		for _, id := range msg.Result.IDList {
+			counts[id]++
+		}
+	}
+	return counts, scanner.Err()
+}
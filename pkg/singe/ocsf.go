@@ -0,0 +1,227 @@
+package singe
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// OCSF schema identifiers of a Detection Finding
+const (
+	OCSFVersion            = "1.1.0"
+	ocsfCategoryFindings   = 2
+	ocsfClassDetection     = 2004
+	ocsfActivityCreate     = 1
+	ocsfStatusNew          = 1
+	ocsfAnalyticTypeRule   = 1
+	ocsfDetectionTypeUID   = ocsfClassDetection*100 + ocsfActivityCreate
+	ocsfDetectionClassName = "Detection Finding"
+)
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+}
+
+type ocsfMetadata struct {
+	Version string      `json:"version"`
+	Product ocsfProduct `json:"product"`
+}
+
+type ocsfAnalytic struct {
+	UID    string `json:"uid,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Desc   string `json:"desc,omitempty"`
+	TypeID int    `json:"type_id"`
+	Type   string `json:"type"`
+}
+
+type ocsfAttackObject struct {
+	UID  string `json:"uid"`
+	Name string `json:"name,omitempty"`
+}
+
+type ocsfAttack struct {
+	Tactic       *ocsfAttackObject `json:"tactic,omitempty"`
+	Technique    *ocsfAttackObject `json:"technique,omitempty"`
+	SubTechnique *ocsfAttackObject `json:"sub_technique,omitempty"`
+	Version      string            `json:"version"`
+}
+
+type ocsfFindingInfo struct {
+	UID      string       `json:"uid"`
+	Title    string       `json:"title"`
+	Desc     string       `json:"desc,omitempty"`
+	Types    []string     `json:"types,omitempty"`
+	SrcURL   string       `json:"src_url,omitempty"`
+	Analytic ocsfAnalytic `json:"analytic"`
+	Attacks  []ocsfAttack `json:"attacks,omitempty"`
+}
+
+type ocsfDetectionFinding struct {
+	ActivityID   int             `json:"activity_id"`
+	ActivityName string          `json:"activity_name"`
+	CategoryUID  int             `json:"category_uid"`
+	CategoryName string          `json:"category_name"`
+	ClassUID     int             `json:"class_uid"`
+	ClassName    string          `json:"class_name"`
+	TypeUID      int             `json:"type_uid"`
+	TypeName     string          `json:"type_name"`
+	SeverityID   int             `json:"severity_id"`
+	Severity     string          `json:"severity"`
+	StatusID     int             `json:"status_id"`
+	Status       string          `json:"status"`
+	Time         int64           `json:"time"`
+	Message      string          `json:"message"`
+	Metadata     ocsfMetadata    `json:"metadata"`
+	FindingInfo  ocsfFindingInfo `json:"finding_info"`
+	RawData      string          `json:"raw_data,omitempty"`
+	Unmapped     sigma.Event     `json:"unmapped,omitempty"`
+}
+
+// ocsfSeverity maps Sigma levels to OCSF severity IDs and captions
+// The Sigma levels share the numbering of OCSF severities from Unknown (0) to Critical (5)
+func ocsfSeverity(level types.Level) (int, string) {
+	switch level {
+	case types.InformationalLevel:
+		return int(level), "Informational"
+	case types.LowLevel:
+		return int(level), "Low"
+	case types.MediumLevel:
+		return int(level), "Medium"
+	case types.HighLevel:
+		return int(level), "High"
+	case types.CriticalLevel:
+		return int(level), "Critical"
+	}
+	return 0, "Unknown"
+}
+
+// newOCSFAttacks returns the OCSF ATT&CK mappings of the ATT&CK tags of a rule
+func newOCSFAttacks(tags []attack.Tag) []ocsfAttack {
+	var tactics []attack.Tag
+	var output []ocsfAttack
+	for _, tag := range tags {
+		if tag.Kind == attack.Tactic {
+			tactics = append(tactics, tag)
+		}
+	}
+	// tacticFor picks the rule tactic that the technique belongs to, if known
+	tacticFor := func(technique attack.Tag) *ocsfAttackObject {
+		if len(tactics) == 0 {
+			return nil
+		}
+		chosen := tactics[0]
+		for _, tactic := range tactics {
+			if tools.Contains(technique.Tactics, tactic.Tactics[0]) {
+				chosen = tactic
+				break
+			}
+		}
+		return &ocsfAttackObject{UID: chosen.ID, Name: chosen.Name}
+	}
+
+	for _, tag := range tags {
+		switch tag.Kind {
+		case attack.Technique:
+			output = append(output, ocsfAttack{
+				Tactic:    tacticFor(tag),
+				Technique: &ocsfAttackObject{UID: tag.ID, Name: tag.Name},
+				Version:   attack.AttackVersion,
+			})
+		case attack.SubTechnique:
+			output = append(output, ocsfAttack{
+				Tactic:       tacticFor(tag),
+				Technique:    &ocsfAttackObject{UID: tag.Technique},
+				SubTechnique: &ocsfAttackObject{UID: tag.ID, Name: tag.Name},
+				Version:      attack.AttackVersion,
+			})
+		}
+	}
+	// Rules tagged only with tactics still map to them
+	if len(output) == 0 {
+		for _, tactic := range tactics {
+			output = append(output, ocsfAttack{
+				Tactic:  &ocsfAttackObject{UID: tactic.ID, Name: tactic.Name},
+				Version: attack.AttackVersion,
+			})
+		}
+	}
+	return output
+}
+
+// newOCSFFinding returns the OCSF Detection Finding of a single matching rule
+func newOCSFFinding(event sigma.Event, original string, rule RuleData, now time.Time) ocsfDetectionFinding {
+	severityID, severity := ocsfSeverity(types.ToLevel(rule.Level))
+	finding := ocsfDetectionFinding{
+		ActivityID:   ocsfActivityCreate,
+		ActivityName: "Create",
+		CategoryUID:  ocsfCategoryFindings,
+		CategoryName: "Findings",
+		ClassUID:     ocsfClassDetection,
+		ClassName:    ocsfDetectionClassName,
+		TypeUID:      ocsfDetectionTypeUID,
+		TypeName:     ocsfDetectionClassName + ": Create",
+		SeverityID:   severityID,
+		Severity:     severity,
+		StatusID:     ocsfStatusNew,
+		Status:       "New",
+		Time:         now.UnixNano() / int64(time.Millisecond),
+		Message:      rule.Title,
+		Metadata: ocsfMetadata{
+			Version: OCSFVersion,
+			Product: ocsfProduct{Name: "singe", VendorName: "Adversary-Informed-Defense"},
+		},
+		FindingInfo: ocsfFindingInfo{
+			UID:   tools.NewUUID(),
+			Title: rule.Title,
+			Desc:  rule.Description,
+			Types: []string{"Sigma"},
+			Analytic: ocsfAnalytic{
+				UID:    rule.ID,
+				Name:   rule.Title,
+				Desc:   rule.Description,
+				TypeID: ocsfAnalyticTypeRule,
+				Type:   "Rule",
+			},
+			Attacks: newOCSFAttacks(rule.Attack),
+		},
+		RawData: original,
+	}
+	if len(rule.References) > 0 {
+		finding.FindingInfo.SrcURL = rule.References[0]
+	}
+	// Only structured events carry fields that OCSF has no mapping for
+	if fields, ok := event.(sigma.DynamicMap); ok {
+		finding.Unmapped = fields
+	}
+	return finding
+}
+
+// encodeOCSF returns one newline delimited OCSF Detection Finding per matching rule of the output message
+func encodeOCSF(msg OutputMessage) ([]byte, error) {
+	original, err := msg.original()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	var buf bytes.Buffer
+	for i, rule := range msg.Result.MatchList {
+		doc, err := json.Marshal(newOCSFFinding(msg.Event, original, rule.RuleData, now))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(doc)
+	}
+	return buf.Bytes(), nil
+}
@@ -1,13 +1,28 @@
 package singe
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
 )
 
 type RuleData struct {
-	ID    string   `json:"id"`
-	Title string   `json:"name"`
-	Tags  []string `json:"tags"`
+	ID          string           `json:"id"`
+	Title       string           `json:"name"`
+	Tags        []string         `json:"tags"`
+	Attack      []attack.Tag     `json:"attack,omitempty"`
+	Level       string           `json:"level,omitempty"`
+	Status      string           `json:"status,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Author      string           `json:"author,omitempty"`
+	References  []string         `json:"references,omitempty"`
+	Logsource   *sigma.Logsource `json:"logsource,omitempty"`
 }
 
 type Rule struct {
@@ -15,13 +30,130 @@ type Rule struct {
 }
 
 type EngineResult struct {
-	MatchList []Rule   `json:"matches"`
-	TagList   []string `json:"tags"`
-	IDList    []string `json:"ids"`
-	Count     int      `json:"count"`
+	MatchList  []Rule       `json:"matches"`
+	TagList    []string     `json:"tags"`
+	AttackList []attack.Tag `json:"attack,omitempty"`
+	IDList     []string     `json:"ids"`
+	Count      int          `json:"count"`
 }
 
 type OutputMessage struct {
 	Event  sigma.Event  `json:"event"`
 	Result EngineResult `json:"sigma"`
+
+	// raw holds the log message the event was cast from
+	raw string
+}
+
+// NewOutputMessage returns the output message of an event matched by the rules argument
+// It is used to emit events that are derived from matches, such as suppression summaries
+func NewOutputMessage(event sigma.Event, rules []Rule) OutputMessage {
+	return newOutputMessage(event, "", rules)
+}
+
+// newOutputMessage returns the output message of an event matched by the rules argument
+func newOutputMessage(event sigma.Event, raw string, rules []Rule) OutputMessage {
+	outputResult := EngineResult{
+		MatchList: rules,
+		Count:     len(rules),
+	}
+	var allTags []string
+	var allIDs []string
+	seenAttack := make(map[string]bool)
+	for _, rule := range rules {
+		allTags = append(allTags, rule.Tags...)
+		allIDs = append(allIDs, rule.ID)
+		for _, tag := range rule.Attack {
+			if !seenAttack[tag.ID] {
+				seenAttack[tag.ID] = true
+				outputResult.AttackList = append(outputResult.AttackList, tag)
+			}
+		}
+	}
+
+	// Remove repeated tags
+	outputResult.TagList = tools.RemoveStringDuplicates(allTags)
+
+	// Rule IDs are unique, the loader rejects duplicates and generates the IDs of rules without one
+	outputResult.IDList = allIDs
+
+	return OutputMessage{Event: event, Result: outputResult, raw: raw}
+}
+
+// Filter returns a copy of the output message restricted to the matching rules kept by the keep argument, and whether any rule was kept
+func (o OutputMessage) Filter(keep func(RuleData) bool) (OutputMessage, bool) {
+	var rules []Rule
+	for _, rule := range o.Result.MatchList {
+		if keep(rule.RuleData) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return OutputMessage{}, false
+	}
+	if len(rules) == len(o.Result.MatchList) {
+		return o, true
+	}
+	return newOutputMessage(o.Event, o.raw, rules), true
+}
+
+// Format represents the enumerated encodings of match results
+type Format int64
+
+const (
+	JSONFormat Format = iota
+	ECSFormat
+	OCSFFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSONFormat:
+		return "json"
+	case ECSFormat:
+		return "ecs"
+	case OCSFFormat:
+		return "ocsf"
+	}
+	return "Unreachable: unknown format"
+}
+
+// ParseFormat returns the enumerated format of a format name
+func ParseFormat(str string) (Format, error) {
+	switch strings.ToLower(str) {
+	case "json":
+		return JSONFormat, nil
+	case "ecs":
+		return ECSFormat, nil
+	case "ocsf":
+		return OCSFFormat, nil
+	}
+	return JSONFormat, fmt.Errorf("unknown output format: %s", str)
+}
+
+// Encode encodes an output message in the format
+func (f Format) Encode(msg OutputMessage) ([]byte, error) {
+	switch f {
+	case ECSFormat:
+		return encodeECS(msg)
+	case OCSFFormat:
+		return encodeOCSF(msg)
+	default:
+		return json.Marshal(msg)
+	}
+}
+
+// original returns the log message the output message's event was cast from
+func (o OutputMessage) original() (string, error) {
+	if o.raw != "" {
+		return o.raw, nil
+	}
+	if str, ok := o.Event.(types.StaticString); ok {
+		return str.Message, nil
+	}
+	raw, err := json.Marshal(o.Event)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
 }
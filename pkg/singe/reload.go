@@ -0,0 +1,346 @@
+package singe
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+)
+
+// RuleDiff lists the rule IDs that differ between two engines
+// Rules without an ID are identified by their path
+type RuleDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Empty returns whether the engines hold the same rules
+func (d RuleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d RuleDiff) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// ruleDigests returns a digest of each rule of an engine, keyed by rule ID
+func ruleDigests(engine SigmaEngine) map[string]string {
+	digests := make(map[string]string)
+	for _, rule := range engine.Rules() {
+		key := rule.ID
+		if key == "" {
+			key = rule.Path
+		}
+		data, err := yaml.Marshal(rule.Rule)
+		if err != nil {
+			continue
+		}
+		sum := sha1.Sum(data)
+		digests[key] = hex.EncodeToString(sum[:])
+	}
+	return digests
+}
+
+// DiffRules returns the rules added, removed and changed from the old engine to the new one
+func DiffRules(old SigmaEngine, new SigmaEngine) RuleDiff {
+	var diff RuleDiff
+	oldDigests, newDigests := ruleDigests(old), ruleDigests(new)
+	for id, digest := range newDigests {
+		oldDigest, ok := oldDigests[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, id)
+		case oldDigest != digest:
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range oldDigests {
+		if _, ok := newDigests[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// ReloadFunc is called after each reload attempt of a watched engine with the diff of the swapped in rules,
+// or with the error that kept the previous rules in place
+type ReloadFunc func(diff RuleDiff, err error)
+
+// ReloadableEngine matches log messages against an engine that is rebuilt when its rule source changes
+// Reloads build the new engine in the background and swap it in atomically, so concurrent matches see either the
+// previous or the new rules and are never blocked
+type ReloadableEngine struct {
+	source    RuleSource
+	opts      []LoadOption
+	configure func(SigmaEngine) SigmaEngine
+
+	engine atomic.Value
+	// mu serializes reloads
+	mu          sync.Mutex
+	fingerprint string
+	// rejected is the digest of the last source snapshot that failed to load, which is not retried until it changes
+	rejected string
+	// files holds the state of the rule files read by the last snapshot by path
+	files map[string]fileState
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReloadableEngine loads the rules of the source argument into a ReloadableEngine
+// Rule files that fail to load are skipped as by NewEngineFrom, unless the FailOnError option is set
+// The configure argument, if not nil, is applied to each loaded engine, e.g. to set its output format or exceptions
+// Sources that are consumed when read, such as readers and tar streams, cannot be reloaded
+func NewReloadableEngine(source RuleSource, configure func(SigmaEngine) SigmaEngine, opts ...LoadOption) (*ReloadableEngine, error) {
+	r := &ReloadableEngine{source: source, opts: opts, configure: configure}
+	files, fingerprint, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	engine, err := r.load(files, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.engine.Store(engine)
+	r.fingerprint = fingerprint
+	return r, nil
+}
+
+// fileState is the size and modification time of a rule file when it was last read, with the digest of its content
+type fileState struct {
+	size    int64
+	modTime time.Time
+	digest  [sha1.Size]byte
+}
+
+// snapshot lists the rule files of the source, returning them with a digest of their paths and contents
+// Files whose size and modification time did not change since the previous snapshot are not read again, their digest is
+// reused and they are read when the engine is built; other files are read once and the engine is built from that content
+// The caller must hold the reload lock
+func (r *ReloadableEngine) snapshot() ([]tools.RuleFile, string, error) {
+	files, err := r.source()
+	if err != nil {
+		return nil, "", err
+	}
+	states := make(map[string]fileState, len(files))
+	hash := sha1.New()
+	for i, file := range files {
+		var info os.FileInfo
+		if file.Stat != nil {
+			info, _ = file.Stat()
+		}
+		if state, ok := r.files[file.Path]; ok && info != nil && state.size == info.Size() && state.modTime.Equal(info.ModTime()) {
+			fmt.Fprintf(hash, "%s\x00", file.Path)
+			hash.Write(state.digest[:])
+			states[file.Path] = state
+			continue
+		}
+		data, err := file.Read()
+		var digest [sha1.Size]byte
+		if err != nil {
+			// Read errors are reported by the loader, unless the file is excluded by a path filter
+			digest = sha1.Sum([]byte("error\x00" + err.Error()))
+		} else {
+			digest = sha1.Sum(data)
+			if info != nil {
+				states[file.Path] = fileState{size: info.Size(), modTime: info.ModTime(), digest: digest}
+			}
+		}
+		fmt.Fprintf(hash, "%s\x00", file.Path)
+		hash.Write(digest[:])
+		files[i].Read = func() ([]byte, error) {
+			return data, err
+		}
+	}
+	r.files = states
+	return files, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// load builds an engine from a snapshot of the source with the load options, like NewEngineFrom
+// On reload, the current argument is the engine to replace, and the new engine is rejected if a rule file fails to load
+// that did not already fail in it, so that a broken edit keeps the previous rules while rules that never loaded do not
+// block every reload
+func (r *ReloadableEngine) load(files []tools.RuleFile, current *SigmaEngine) (SigmaEngine, error) {
+	source := func() ([]tools.RuleFile, error) {
+		return files, nil
+	}
+	engine, err := NewEngineFrom(source, r.opts...)
+	if err != nil {
+		return SigmaEngine{}, err
+	}
+	if current != nil {
+		if err := newLoadErrors(current.LoadReport(), engine.LoadReport()); err != nil {
+			return SigmaEngine{}, err
+		}
+	}
+	if r.configure != nil {
+		engine = r.configure(engine)
+	}
+	return engine, nil
+}
+
+// newLoadErrors returns an error listing the rule files that failed to load in the next report but not in the previous
+// one, and the rules that loaded in the previous report but are unsupported in the next one
+// Rules are matched by ID, and by path and position for rules whose ID changed
+func newLoadErrors(previous tools.LoadReport, next tools.LoadReport) error {
+	type position struct {
+		path string
+		part int
+	}
+	failed := make(map[string]bool)
+	loadedIDs := make(map[string]bool)
+	loadedPositions := make(map[position]bool)
+	for _, rule := range previous.Rules {
+		switch rule.Status {
+		case tools.FailedStatus:
+			failed[rule.Path] = true
+		case tools.LoadedStatus:
+			loadedIDs[rule.ID] = true
+			loadedPositions[position{rule.Path, rule.Part}] = true
+		}
+	}
+	var rules []tools.RuleReport
+	for _, rule := range next.Rules {
+		switch rule.Status {
+		case tools.FailedStatus:
+			if !failed[rule.Path] {
+				rules = append(rules, rule)
+			}
+		case tools.UnsupportedStatus:
+			if rule.ID != "" && loadedIDs[rule.ID] || loadedPositions[position{rule.Path, rule.Part}] {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return tools.LoadError{Rules: rules}
+}
+
+// Engine returns the current engine
+func (r *ReloadableEngine) Engine() SigmaEngine {
+	return r.engine.Load().(SigmaEngine)
+}
+
+// Match evaluates a log message against the current rules, see SigmaEngine.Match
+func (r *ReloadableEngine) Match(msg string, vendor string) ([]byte, bool, error) {
+	return r.Engine().Match(msg, vendor)
+}
+
+// Evaluate evaluates a log message against the current rules, see SigmaEngine.Evaluate
+func (r *ReloadableEngine) Evaluate(msg string, vendor string) (OutputMessage, bool, error) {
+	return r.Engine().Evaluate(msg, vendor)
+}
+
+// Scan evaluates each line of a log against the rules current at the time the line is read, see SigmaEngine.Scan
+func (r *ReloadableEngine) Scan(reader io.Reader, vendor string, fn ScanFunc) error {
+	return scan(reader, vendor, r.Evaluate, fn)
+}
+
+// Reload rebuilds the engine from its source and swaps it in, returning the diff of the rules
+// The current engine is kept if the source cannot be read, a rule fails to load that loaded or did not exist before,
+// or a rule that loaded before is now unsupported
+func (r *ReloadableEngine) Reload() (RuleDiff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	diff, _, err := r.reload(false)
+	return diff, err
+}
+
+// reload rebuilds the engine, returning whether a reload was attempted
+// If the changed argument is set, the engine is only rebuilt when the source differs from the current and the last
+// rejected snapshots
+// The caller must hold the reload lock
+func (r *ReloadableEngine) reload(changed bool) (RuleDiff, bool, error) {
+	files, fingerprint, err := r.snapshot()
+	if err != nil {
+		return RuleDiff{}, true, err
+	}
+	if changed && (fingerprint == r.fingerprint || fingerprint == r.rejected) {
+		return RuleDiff{}, false, nil
+	}
+	current := r.Engine()
+	engine, err := r.load(files, &current)
+	if err != nil {
+		r.rejected = fingerprint
+		return RuleDiff{}, true, err
+	}
+	diff := DiffRules(current, engine)
+	r.engine.Store(engine)
+	r.fingerprint = fingerprint
+	r.rejected = ""
+	return diff, true, nil
+}
+
+// Watch polls the source every interval and reloads the engine when its rule files change, until Close is called
+// The onReload argument, if not nil, is called after each reload attempt; otherwise reloads are logged
+func (r *ReloadableEngine) Watch(interval time.Duration, onReload ReloadFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return
+	}
+	if onReload == nil {
+		onReload = logReload
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.watch(interval, onReload, r.stop, r.done)
+}
+
+// watch runs the polling loop of Watch
+func (r *ReloadableEngine) watch(interval time.Duration, onReload ReloadFunc, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			diff, reloaded, err := r.reload(true)
+			r.mu.Unlock()
+			if reloaded {
+				onReload(diff, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// logReload logs the outcome of a reload attempt
+func logReload(diff RuleDiff, err error) {
+	if err != nil {
+		logrus.Errorf("Failed to reload sigma rules, keeping the previous rules: %s", err)
+		return
+	}
+	logrus.Infof("Reloaded sigma rules: %s", diff)
+}
+
+// Close stops watching the source
+func (r *ReloadableEngine) Close() error {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
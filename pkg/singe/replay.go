@@ -0,0 +1,169 @@
+package singe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultReplayExamples is the number of example events kept per rule for each kind of change in a replay
+const DefaultReplayExamples = 3
+
+// Evaluator evaluates a log message against a ruleset, implemented by SigmaEngine and ReloadableEngine
+type Evaluator interface {
+	Evaluate(msg string, vendor string) (OutputMessage, bool, error)
+}
+
+// ReplayExample is a corpus event whose match by a rule changed
+type ReplayExample struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Event  string `json:"event"`
+}
+
+// RuleReplay counts the corpus events matched by a rule in the baseline engine, the candidate engine or both
+type RuleReplay struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// New counts the events matched by the candidate only
+	New int `json:"new"`
+	// Lost counts the events matched by the baseline only
+	Lost       int             `json:"lost"`
+	Unchanged  int             `json:"unchanged"`
+	NewEvents  []ReplayExample `json:"new_events,omitempty"`
+	LostEvents []ReplayExample `json:"lost_events,omitempty"`
+}
+
+// Changed returns whether the rule gained or lost any event
+func (r RuleReplay) Changed() bool {
+	return r.New > 0 || r.Lost > 0
+}
+
+func (r RuleReplay) String() string {
+	return fmt.Sprintf("%s %s: %d new, %d lost, %d unchanged", r.ID, r.Title, r.New, r.Lost, r.Unchanged)
+}
+
+// ReplayReport is the match diff of a corpus replayed through a baseline and a candidate engine
+type ReplayReport struct {
+	Events int `json:"events"`
+	// Errors counts the events that either engine failed to evaluate, they are not diffed
+	Errors int `json:"errors"`
+	// Rules holds every rule that matched an event in either engine, sorted by ID
+	Rules []RuleReplay `json:"rules"`
+}
+
+// Changed returns the rules that gained or lost events
+func (r ReplayReport) Changed() []RuleReplay {
+	var changed []RuleReplay
+	for _, rule := range r.Rules {
+		if rule.Changed() {
+			changed = append(changed, rule)
+		}
+	}
+	return changed
+}
+
+// Replayer runs a corpus of events through a baseline and a candidate engine, such as the rules before and after a
+// rule pack upgrade or a mapping change, and diffs the events matched by each rule
+type Replayer struct {
+	baseline  Evaluator
+	candidate Evaluator
+	examples  int
+	events    int
+	errors    int
+	rules     map[string]*RuleReplay
+}
+
+// NewReplayer returns a replayer of the baseline and candidate engines keeping up to examples events per rule and change
+func NewReplayer(baseline Evaluator, candidate Evaluator, examples int) *Replayer {
+	return &Replayer{
+		baseline:  baseline,
+		candidate: candidate,
+		examples:  examples,
+		rules:     make(map[string]*RuleReplay),
+	}
+}
+
+// Replay evaluates each line of a corpus log in both engines, the source names the log in the examples
+// Empty lines are skipped, lines that either engine fails to evaluate are counted as errors
+func (r *Replayer) Replay(source string, log io.Reader, vendor string) error {
+	scanner := bufio.NewScanner(log)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		r.events++
+		baseline, _, err := r.baseline.Evaluate(text, vendor)
+		if err != nil {
+			r.errors++
+			continue
+		}
+		candidate, _, err := r.candidate.Evaluate(text, vendor)
+		if err != nil {
+			r.errors++
+			continue
+		}
+		r.add(ReplayExample{Source: source, Line: line, Event: text}, baseline.Result.MatchList, candidate.Result.MatchList)
+	}
+	return scanner.Err()
+}
+
+// add diffs the rules matching an event in the baseline and candidate engines
+func (r *Replayer) add(example ReplayExample, baseline []Rule, candidate []Rule) {
+	matched := make(map[string]bool, len(baseline))
+	for _, rule := range baseline {
+		matched[strings.ToLower(rule.ID)] = true
+	}
+	for _, rule := range candidate {
+		key := strings.ToLower(rule.ID)
+		diff := r.rule(rule.RuleData)
+		if matched[key] {
+			diff.Unchanged++
+			delete(matched, key)
+			continue
+		}
+		diff.New++
+		if len(diff.NewEvents) < r.examples {
+			diff.NewEvents = append(diff.NewEvents, example)
+		}
+	}
+	for _, rule := range baseline {
+		if !matched[strings.ToLower(rule.ID)] {
+			continue
+		}
+		diff := r.rule(rule.RuleData)
+		diff.Lost++
+		if len(diff.LostEvents) < r.examples {
+			diff.LostEvents = append(diff.LostEvents, example)
+		}
+	}
+}
+
+// rule returns the diff of a rule, created with the title of its first match
+func (r *Replayer) rule(data RuleData) *RuleReplay {
+	key := strings.ToLower(data.ID)
+	diff, ok := r.rules[key]
+	if !ok {
+		diff = &RuleReplay{ID: data.ID, Title: data.Title}
+		r.rules[key] = diff
+	}
+	return diff
+}
+
+// Report returns the match diff of the events replayed so far
+func (r *Replayer) Report() ReplayReport {
+	report := ReplayReport{Events: r.events, Errors: r.errors, Rules: make([]RuleReplay, 0, len(r.rules))}
+	for _, diff := range r.rules {
+		report.Rules = append(report.Rules, *diff)
+	}
+	sort.Slice(report.Rules, func(i, j int) bool {
+		return strings.ToLower(report.Rules[i].ID) < strings.ToLower(report.Rules[j].ID)
+	})
+	return report
+}
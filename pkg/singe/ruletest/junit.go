@@ -0,0 +1,91 @@
+package ruletest
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// junitTestsuites is the root element of a JUnit XML report
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+// junitTestsuite holds the samples of a rule file
+type junitTestsuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+// junitTestcase is the outcome of a sample
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// junitMessage is the failure, error or skip reason of a test case
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per rule file and a test case per sample
+// Rule files whose samples could not run are reported as a single test case with an error
+func (r Report) WriteJUnit(w io.Writer) error {
+	root := junitTestsuites{Name: "singe"}
+	for _, rule := range r.Rules {
+		suite := junitTestsuite{Name: rule.Path}
+		classname := rule.Title
+		if classname == "" {
+			classname = rule.Path
+		}
+		if rule.Err != nil {
+			suite.Errors = 1
+			suite.Cases = append(suite.Cases, junitTestcase{
+				Name:      "samples",
+				Classname: classname,
+				Error:     &junitMessage{Message: rule.Err.Error()},
+			})
+		}
+		for _, sample := range rule.Samples {
+			testcase := junitTestcase{Name: sample.Name, Classname: classname}
+			switch {
+			case sample.Skipped:
+				suite.Skipped++
+				testcase.Skipped = &junitMessage{Message: "rule filtered out of the engine"}
+			case !sample.Passed:
+				suite.Failures++
+				testcase.Failure = &junitMessage{Message: sample.Failure, Text: sample.Expect.String()}
+			}
+			suite.Cases = append(suite.Cases, testcase)
+		}
+		suite.Tests = len(suite.Cases)
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Errors += suite.Errors
+		root.Skipped += suite.Skipped
+		root.Suites = append(root.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,341 @@
+package ruletest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+)
+
+// SampleAttribute is the custom Sigma rule attribute that holds the test samples of a rule, e.g.
+//
+//	tests:
+//	  - name: whoami execution
+//	    expect: match
+//	    event:
+//	      Image: 'C:\Windows\System32\whoami.exe'
+//	  - name: notepad execution
+//	    expect: no_match
+//	    vendor: json
+//	    event: '{"Image": "C:\\Windows\\System32\\notepad.exe"}'
+//
+// Samples can also be kept in a sidecar file named after the rule file with the tools.SampleSuffix, holding the same attribute
+const SampleAttribute = "tests"
+
+// Expectation represents the enumerated outcomes expected of a sample event
+type Expectation int64
+
+const (
+	MustMatch Expectation = iota
+	MustNotMatch
+)
+
+func (e Expectation) String() string {
+	switch e {
+	case MustMatch:
+		return "match"
+	case MustNotMatch:
+		return "no_match"
+	}
+	return "Unreachable: unknown expectation"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (e Expectation) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (e *Expectation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	switch strings.ToLower(str) {
+	case "match":
+		*e = MustMatch
+	case "no_match":
+		*e = MustNotMatch
+	default:
+		return fmt.Errorf("unknown expectation %q, must be match or no_match", str)
+	}
+	return nil
+}
+
+// Sample is a sample event of a rule test
+type Sample struct {
+	Name string `yaml:"name"`
+	// Rule is the ID of the tested rule, every rule of the rule file unless set
+	Rule string `yaml:"rule"`
+	// Vendor is the log vendor of the event, json unless set
+	Vendor string `yaml:"vendor"`
+	// Expect is whether a tested rule must match the event, the default, or none of them
+	Expect Expectation `yaml:"expect"`
+	// Event is the log message, either a string or a YAML map that is encoded as JSON
+	Event interface{} `yaml:"event"`
+}
+
+// message returns the log message of the sample's event
+func (s Sample) message() (string, error) {
+	if str, ok := s.Event.(string); ok {
+		return str, nil
+	}
+	if s.Event == nil {
+		return "", fmt.Errorf("missing event")
+	}
+	encoded, err := json.Marshal(jsonValue(s.Event))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// jsonValue converts the maps decoded from YAML to maps with string keys that can be encoded as JSON
+func jsonValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = jsonValue(elem)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			list[i] = jsonValue(elem)
+		}
+		return list
+	}
+	return val
+}
+
+// LoadSamples returns the test samples of the rule file at the path argument, from its tests attribute followed by
+// its sidecar file
+func LoadSamples(path string, data []byte) ([]Sample, error) {
+	var doc struct {
+		Tests []Sample `yaml:"tests"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, SampleAttribute, err)
+	}
+	samples := doc.Tests
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext) + tools.SampleSuffix
+	for _, sidecarExt := range []string{".yml", ".yaml"} {
+		sidecar := base + sidecarExt
+		sidecarData, err := ioutil.ReadFile(sidecar)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc.Tests = nil
+		if err := yaml.UnmarshalStrict(sidecarData, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", sidecar, err)
+		}
+		samples = append(samples, doc.Tests...)
+	}
+	return samples, nil
+}
+
+// SampleResult is the outcome of a sample
+type SampleResult struct {
+	Sample
+	// Matched lists the IDs of the tested rules that matched the event
+	Matched []string
+	Passed  bool
+	// Skipped is set if the tested rules were filtered out of the engine
+	Skipped bool
+	// Failure explains why the sample did not pass
+	Failure string
+}
+
+// RuleResult is the outcome of the samples of a rule file
+type RuleResult struct {
+	Path  string
+	Title string
+	// IDs are the IDs of the rules of the file
+	IDs     []string
+	Samples []SampleResult
+	// Err is the error that kept the samples from running, such as an invalid sidecar file
+	Err error
+}
+
+// Failures returns the number of samples that neither passed nor were skipped
+func (r RuleResult) Failures() int {
+	count := 0
+	for _, sample := range r.Samples {
+		if !sample.Passed && !sample.Skipped {
+			count++
+		}
+	}
+	return count
+}
+
+// Passed returns whether every sample of the rule file passed or was skipped
+func (r RuleResult) Passed() bool {
+	return r.Err == nil && r.Failures() == 0
+}
+
+// Report is the outcome of the samples of the rules in a directory
+type Report struct {
+	Rules []RuleResult
+	// Untested lists the rule files without samples
+	Untested []string
+}
+
+// Failures returns the number of rule files that did not pass
+func (r Report) Failures() int {
+	count := 0
+	for _, rule := range r.Rules {
+		if !rule.Passed() {
+			count++
+		}
+	}
+	return count
+}
+
+// Run loads the rules in the directory at the path argument with NewEngine, then evaluates the samples of every
+// rule file as Match would, reporting whether each sample passed
+// The samples of rules excluded by the load options are skipped, those of rules that failed to load fail
+// With the FailOnError option, rule files that failed to load also fail when they have no samples
+func Run(path string, opts ...singe.LoadOption) (Report, error) {
+	var report Report
+	files, err := tools.DirFiles(path)
+	if err != nil {
+		return report, err
+	}
+	engine, err := singe.NewEngine(path, opts...)
+	var loadErr tools.LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		return report, err
+	}
+	failed := make(map[string]error)
+	for _, rule := range loadErr.Rules {
+		if failed[rule.Path] == nil {
+			failed[rule.Path] = rule.Err
+		}
+	}
+	statuses := make(map[string]map[string]tools.RuleReport)
+	for _, rule := range engine.LoadReport().Rules {
+		if statuses[rule.Path] == nil {
+			statuses[rule.Path] = make(map[string]tools.RuleReport)
+		}
+		statuses[rule.Path][rule.ID] = rule
+	}
+
+	for _, file := range files {
+		result := RuleResult{Path: file.Path}
+		data, err := file.Read()
+		if err != nil {
+			result.Err = err
+			report.Rules = append(report.Rules, result)
+			continue
+		}
+		samples, err := LoadSamples(file.Path, data)
+		if err != nil {
+			result.Err = err
+			report.Rules = append(report.Rules, result)
+			continue
+		}
+		if len(samples) == 0 {
+			if err := failed[file.Path]; err != nil {
+				result.Err = err
+				report.Rules = append(report.Rules, result)
+				continue
+			}
+			report.Untested = append(report.Untested, file.Path)
+			continue
+		}
+		rules, err := tools.ParseRuleFile(data)
+		if err != nil {
+			result.Err = err
+			report.Rules = append(report.Rules, result)
+			continue
+		}
+		result.Title = rules[0].Title
+		for _, rule := range rules {
+			result.IDs = append(result.IDs, rule.ID)
+		}
+		for i, sample := range samples {
+			if sample.Name == "" {
+				sample.Name = fmt.Sprintf("sample %d", i+1)
+			}
+			result.Samples = append(result.Samples, runSample(engine, sample, result.IDs, statuses[file.Path]))
+		}
+		report.Rules = append(report.Rules, result)
+	}
+	return report, nil
+}
+
+// runSample evaluates a sample against the tested rules of a file, given the load outcome of the file's rules by ID
+// A must-match sample passes if any tested rule matches it, a must-not-match sample if none does
+func runSample(engine singe.SigmaEngine, sample Sample, ids []string, statuses map[string]tools.RuleReport) SampleResult {
+	result := SampleResult{Sample: sample}
+	tested := ids
+	if sample.Rule != "" {
+		tested = []string{sample.Rule}
+	}
+	var loaded []string
+	for _, id := range tested {
+		status, ok := statuses[id]
+		switch {
+		case !ok:
+			result.Failure = fmt.Sprintf("rule %s is not in the rule file", id)
+			return result
+		case status.Status == tools.LoadedStatus:
+			loaded = append(loaded, id)
+		case status.Status != tools.FilteredStatus:
+			result.Failure = fmt.Sprintf("rule %s is %s: %s", id, status.Status, status.Err)
+			return result
+		}
+	}
+	if len(loaded) == 0 {
+		result.Skipped = true
+		return result
+	}
+
+	msg, err := sample.message()
+	if err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+	vendor := sample.Vendor
+	if vendor == "" {
+		vendor = "json"
+	}
+	output, _, err := engine.Evaluate(msg, vendor)
+	if err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+	for _, id := range output.Result.IDList {
+		for _, loadedID := range loaded {
+			if strings.EqualFold(id, loadedID) {
+				result.Matched = append(result.Matched, id)
+			}
+		}
+	}
+	switch sample.Expect {
+	case MustMatch:
+		result.Passed = len(result.Matched) > 0
+		if !result.Passed {
+			result.Failure = "expected a match, the event matched no tested rule"
+		}
+	case MustNotMatch:
+		result.Passed = len(result.Matched) == 0
+		if !result.Passed {
+			result.Failure = fmt.Sprintf("expected no match, the event matched %s", strings.Join(result.Matched, ", "))
+		}
+	}
+	return result
+}
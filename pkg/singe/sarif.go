@@ -0,0 +1,217 @@
+package singe
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// SARIF format identifiers
+const (
+	SARIFVersion = "2.1.0"
+	SARIFSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolInfoURI  = "https://github.com/Adversary-Informed-Defense/singe"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                `json:"name"`
+	InformationURI string                `json:"informationUri"`
+	Rules          []sarifRuleDescriptor `json:"rules"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleDescriptor struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name,omitempty"`
+	ShortDescription     sarifText              `json:"shortDescription"`
+	FullDescription      *sarifText             `json:"fullDescription,omitempty"`
+	HelpURI              string                 `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifLevel maps Sigma levels to SARIF result levels
+func sarifLevel(level types.Level) string {
+	switch level {
+	case types.InformationalLevel, types.LowLevel:
+		return "note"
+	case types.HighLevel, types.CriticalLevel:
+		return "error"
+	}
+	return "warning"
+}
+
+// sarifSecuritySeverity maps Sigma levels to the CVSS-like scores read by code scanning UIs
+func sarifSecuritySeverity(level types.Level) string {
+	switch level {
+	case types.InformationalLevel:
+		return "0.0"
+	case types.LowLevel:
+		return "3.0"
+	case types.MediumLevel:
+		return "5.5"
+	case types.HighLevel:
+		return "8.0"
+	case types.CriticalLevel:
+		return "9.5"
+	}
+	return "5.0"
+}
+
+// SARIFWriter collects the matches of a batch scan into a SARIF log
+type SARIFWriter struct {
+	descriptors []sarifRuleDescriptor
+	index       map[string]int
+	results     []sarifResult
+}
+
+// NewSARIFWriter returns a SARIFWriter with one reporting descriptor per rule loaded in the engine
+func NewSARIFWriter(s SigmaEngine) *SARIFWriter {
+	w := &SARIFWriter{
+		descriptors: []sarifRuleDescriptor{},
+		index:       make(map[string]int),
+		results:     []sarifResult{},
+	}
+	for _, rule := range s.Rules() {
+		w.addDescriptor(rule)
+	}
+	return w
+}
+
+// addDescriptor appends the reporting descriptor of a Sigma rule, if not already present
+func (w *SARIFWriter) addDescriptor(rule *sigma.RuleHandle) {
+	if _, ok := w.index[rule.ID]; ok {
+		return
+	}
+	level := types.ToLevel(rule.Level)
+	descriptor := sarifRuleDescriptor{
+		ID:                   rule.ID,
+		Name:                 rule.Title,
+		ShortDescription:     sarifText{Text: rule.Title},
+		DefaultConfiguration: sarifConfiguration{Level: sarifLevel(level)},
+		Properties: map[string]interface{}{
+			"security-severity": sarifSecuritySeverity(level),
+		},
+	}
+	if rule.Description != "" {
+		descriptor.FullDescription = &sarifText{Text: rule.Description}
+	}
+	if len(rule.References) > 0 {
+		descriptor.HelpURI = rule.References[0]
+	}
+	if len(rule.Tags) > 0 {
+		descriptor.Properties["tags"] = rule.Tags
+	}
+	w.index[rule.ID] = len(w.descriptors)
+	w.descriptors = append(w.descriptors, descriptor)
+}
+
+// Add records one result per matching rule of the output message, located at the line of the log file path
+func (w *SARIFWriter) Add(path string, line int, msg OutputMessage) {
+	for _, rule := range msg.Result.MatchList {
+		index, ok := w.index[rule.ID]
+		if !ok {
+			// Matches from rules unknown to the engine still need a descriptor to reference
+			w.addDescriptor(&sigma.RuleHandle{Rule: sigma.Rule{
+				ID:          rule.ID,
+				Title:       rule.Title,
+				Level:       rule.Level,
+				Description: rule.Description,
+				References:  rule.References,
+				Tags:        rule.Tags,
+			}})
+			index = w.index[rule.ID]
+		}
+		w.results = append(w.results, sarifResult{
+			RuleID:    rule.ID,
+			RuleIndex: index,
+			Level:     sarifLevel(types.ToLevel(rule.Level)),
+			Message:   sarifText{Text: rule.Title},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: artifactURI(path)},
+					Region:           sarifRegion{StartLine: line},
+				},
+			}},
+		})
+	}
+}
+
+// artifactURI returns the SARIF URI of a log file path, relative paths being resolved against the scan root by viewers
+func artifactURI(path string) string {
+	if filepath.IsAbs(path) {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+	return filepath.ToSlash(path)
+}
+
+// Write encodes the collected results as a SARIF log
+func (w *SARIFWriter) Write(out io.Writer) error {
+	log := sarifLog{
+		Schema:  SARIFSchema,
+		Version: SARIFVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "singe",
+				InformationURI: toolInfoURI,
+				Rules:          w.descriptors,
+			}},
+			Results: w.results,
+		}},
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
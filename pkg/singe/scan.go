@@ -0,0 +1,46 @@
+package singe
+
+import (
+	"bufio"
+	"io"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// maxLineSize bounds the length of a single log line read by Scan
+const maxLineSize = 16 * 1024 * 1024
+
+// ScanFunc is called by Scan with the line number and output message of each matching log line
+type ScanFunc func(line int, msg OutputMessage) error
+
+// Scan evaluates each line of a log against the Sigma ruleset, calling fn for every line with at least one match
+// Lines that cannot be cast to the vendor's log type are logged and skipped
+func (s SigmaEngine) Scan(r io.Reader, vendor string, fn ScanFunc) error {
+	return scan(r, vendor, s.Evaluate, fn)
+}
+
+// scan evaluates each line of a log with the evaluate argument, see Scan
+func scan(r io.Reader, vendor string, evaluate func(string, string) (OutputMessage, bool, error), fn ScanFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		msg, matched, err := evaluate(text, vendor)
+		if err != nil {
+			logrus.Infof("Error evaluating line %d: %s", line, err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if err := fn(line, msg); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,100 @@
+package singe
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// Selection is the declarative YAML selection of the rules loaded into an engine, e.g.
+//
+//	include:
+//	  statuses: [stable, test]
+//	  min_level: medium
+//	  products: [windows]
+//	exclude:
+//	  paths: [rules/windows/builtin, deprecated]
+//	  globs: ["*/proc_creation_win_susp_*"]
+//	  ids: [e28a5a99-da44-436d-b7a0-2afc20a5f413]
+//
+// Excluded paths are rule files or directories, absolute or relative to the working or rule directory; they are
+// skipped while loading and left on disk
+type Selection struct {
+	Include SelectionInclude `yaml:"include"`
+	Exclude SelectionExclude `yaml:"exclude"`
+}
+
+// SelectionInclude lists the criteria of which a rule must meet every one set to be loaded
+type SelectionInclude struct {
+	Statuses   []string `yaml:"statuses"`
+	MinLevel   string   `yaml:"min_level"`
+	Tags       []string `yaml:"tags"`
+	Products   []string `yaml:"products"`
+	Categories []string `yaml:"categories"`
+	IDs        []string `yaml:"ids"`
+	Globs      []string `yaml:"globs"`
+}
+
+// SelectionExclude lists the criteria of which a rule must meet none to be loaded
+type SelectionExclude struct {
+	Statuses []string `yaml:"statuses"`
+	Tags     []string `yaml:"tags"`
+	IDs      []string `yaml:"ids"`
+	Globs    []string `yaml:"globs"`
+	Paths    []string `yaml:"paths"`
+}
+
+// LoadSelection reads a rule selection from the YAML file at the path argument
+func LoadSelection(path string) (Selection, error) {
+	var selection Selection
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return selection, err
+	}
+	if err := yaml.UnmarshalStrict(data, &selection); err != nil {
+		return selection, fmt.Errorf("%s: %w", path, err)
+	}
+	if selection.Include.MinLevel != "" && types.ToLevel(selection.Include.MinLevel) == types.UnknownLevel {
+		return selection, fmt.Errorf("%s: unknown level %q", path, selection.Include.MinLevel)
+	}
+	return selection, nil
+}
+
+// SelectRules loads only the rules selected by the selection argument
+func SelectRules(selection Selection) LoadOption {
+	return func(c *loadConfig) {
+		include, exclude := selection.Include, selection.Exclude
+		c.filter.Statuses = append(c.filter.Statuses, include.Statuses...)
+		if include.MinLevel != "" {
+			c.filter.MinLevel = types.ToLevel(include.MinLevel)
+		}
+		c.filter.Tags = append(c.filter.Tags, include.Tags...)
+		c.filter.Products = append(c.filter.Products, include.Products...)
+		c.filter.Categories = append(c.filter.Categories, include.Categories...)
+		c.filter.IDs = append(c.filter.IDs, include.IDs...)
+		c.filter.Paths = append(c.filter.Paths, include.Globs...)
+
+		c.filter.ExcludeStatuses = append(c.filter.ExcludeStatuses, exclude.Statuses...)
+		c.filter.ExcludeTags = append(c.filter.ExcludeTags, exclude.Tags...)
+		c.filter.ExcludeIDs = append(c.filter.ExcludeIDs, exclude.IDs...)
+		c.filter.ExcludePaths = append(c.filter.ExcludePaths, exclude.Globs...)
+		c.filter.SkipPaths = append(c.filter.SkipPaths, exclude.Paths...)
+	}
+}
+
+// SkipRulePaths skips the rule files and directories of the path arguments without removing them from disk
+func SkipRulePaths(paths ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.filter.SkipPaths = append(c.filter.SkipPaths, paths...)
+	}
+}
+
+// ExcludeEnvRulesets skips the rule files and directories listed in the DELETE_RULESETS environment variable,
+// the non-destructive replacement of tools.DeleteRules
+func ExcludeEnvRulesets() LoadOption {
+	return SkipRulePaths(tools.GetListEnvVar(tools.DeleteRulesetsEnv)...)
+}
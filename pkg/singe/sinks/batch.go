@@ -0,0 +1,208 @@
+package sinks
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// Default batching settings of bulk sinks
+const (
+	DefaultBatchEvents   = 500
+	DefaultBatchBytes    = 5 * 1024 * 1024
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// ErrClosed is returned by writes to a bulk sink after it was closed
+var ErrClosed = errors.New("sink is closed")
+
+// BatchConfig configures how bulk sinks group output messages into requests
+// Zero values are replaced by the package defaults
+type BatchConfig struct {
+	// MaxEvents is the number of wire entries that triggers a flush
+	MaxEvents int
+	// MaxBytes is the request body size that triggers a flush
+	MaxBytes int
+	// FlushInterval is the longest time an entry waits before being sent
+	FlushInterval time.Duration
+	// DeadLetterPath is the file that entries are appended to when they cannot be delivered
+	// Entries are written in the sink's wire format so they can be replayed as is
+	DeadLetterPath string
+}
+
+// withDefaults returns the batch configuration with unset values replaced by the package defaults
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.MaxEvents <= 0 {
+		c.MaxEvents = DefaultBatchEvents
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = DefaultBatchBytes
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+	return c
+}
+
+// batcher buffers wire entries and sends them in bulk by size or on a timer
+// Full batches are cut from the buffer and queued under mu, then sent under sendMu, so that writers are not blocked by a
+// send and its retries while batches are still delivered in order
+type batcher struct {
+	mu      sync.Mutex
+	config  BatchConfig
+	entries [][]byte
+	size    int
+	// pending holds the batches cut from the buffer that are waiting to be sent, oldest first
+	pending [][][]byte
+	closed  bool
+
+	sendMu sync.Mutex
+	// send delivers a batch, returning the entries that could not be delivered
+	send func(entries [][]byte) ([][]byte, error)
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newBatcher starts the flush timer of a batcher
+func newBatcher(config BatchConfig, send func(entries [][]byte) ([][]byte, error)) *batcher {
+	b := &batcher{
+		config: config.withDefaults(),
+		send:   send,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// run flushes the buffered entries every flush interval until the batcher is closed
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.flush(); err != nil {
+				logrus.Infof("Error flushing batch: %s", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// add buffers wire entries, sending the batch when it is full
+// Entries added after close are rejected with ErrClosed
+func (b *batcher) add(entries ...[]byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	for _, entry := range entries {
+		b.entries = append(b.entries, entry)
+		b.size += len(entry)
+	}
+	full := len(b.entries) >= b.config.MaxEvents || b.size >= b.config.MaxBytes
+	if full {
+		b.cutLocked()
+	}
+	b.mu.Unlock()
+	if full {
+		return b.sendPending()
+	}
+	return nil
+}
+
+// cutLocked queues the buffered entries as a pending batch
+// The caller must hold mu
+func (b *batcher) cutLocked() {
+	if len(b.entries) == 0 {
+		return
+	}
+	b.pending = append(b.pending, b.entries)
+	b.entries = nil
+	b.size = 0
+}
+
+// sendPending sends the pending batches in the order they were cut, returning the first error
+// Batches queued while waiting for another send are sent by whichever caller gets sendMu first
+func (b *batcher) sendPending() error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	var err error
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.mu.Unlock()
+			return err
+		}
+		entries := b.pending[0]
+		b.pending = b.pending[1:]
+		b.mu.Unlock()
+		if sendErr := b.deliver(entries); sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
+}
+
+// deliver sends a batch, dead-lettering the entries that could not be delivered
+func (b *batcher) deliver(entries [][]byte) error {
+	failed, err := b.send(entries)
+	if len(failed) > 0 {
+		if dlqErr := b.deadLetter(failed); dlqErr != nil {
+			logrus.Infof("Error writing %d entries to dead letter file: %s", len(failed), dlqErr)
+			if err == nil {
+				err = dlqErr
+			}
+		}
+	}
+	return err
+}
+
+// deadLetter appends undeliverable entries to the dead letter file, if configured
+func (b *batcher) deadLetter(entries [][]byte) error {
+	if b.config.DeadLetterPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(b.config.DeadLetterPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, entry := range entries {
+		if _, err := f.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush sends the buffered entries immediately
+func (b *batcher) flush() error {
+	b.mu.Lock()
+	b.cutLocked()
+	b.mu.Unlock()
+	return b.sendPending()
+}
+
+// close stops the flush timer and sends the remaining entries
+// Further calls return the error of the first one
+func (b *batcher) close() error {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		close(b.stop)
+		<-b.done
+		b.closeErr = b.flush()
+	})
+	return b.closeErr
+}
@@ -0,0 +1,256 @@
+package sinks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// Config is the YAML configuration of routed output sinks, e.g.
+//
+//	sinks:
+//	  - type: file
+//	    path: /var/log/singe/alerts.jsonl
+//	    max_bytes: 104857600
+//	    max_backups: 5
+//	  - type: webhook
+//	    url: https://hooks.example.com/singe
+//	    min_level: high
+//	  - type: syslog
+//	    network: tcp
+//	    address: siem.example.com:514
+//	    tags: ["attack.t1003*"]
+//	  - type: splunk_hec
+//	    url: https://splunk.example.com:8088
+//	    token: 00000000-0000-0000-0000-000000000000
+//	    index: security
+//	    batch_size: 200
+//	    flush_interval: 2s
+//	    dead_letter: /var/lib/singe/splunk.dlq
+//	  - type: elasticsearch
+//	    url: https://elastic.example.com:9200
+//	    index: logs-singe.alerts-default
+//	    format: ecs
+//	    api_key: base64key
+type Config struct {
+	Sinks []SinkConfig `yaml:"sinks"`
+}
+
+// SinkConfig configures a single routed sink; only the fields of the sink's type are read
+type SinkConfig struct {
+	// Type is one of stdout, file, webhook, syslog, splunk_hec or elasticsearch
+	Type     string   `yaml:"type"`
+	Format   string   `yaml:"format"`
+	MinLevel string   `yaml:"min_level"`
+	Tags     []string `yaml:"tags"`
+
+	Path       string `yaml:"path"`
+	MaxBytes   int64  `yaml:"max_bytes"`
+	MaxBackups int    `yaml:"max_backups"`
+
+	URL        string            `yaml:"url"`
+	Headers    map[string]string `yaml:"headers"`
+	Timeout    string            `yaml:"timeout"`
+	MaxRetries int               `yaml:"max_retries"`
+	Backoff    string            `yaml:"backoff"`
+	MaxBackoff string            `yaml:"max_backoff"`
+
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Facility int    `yaml:"facility"`
+	AppName  string `yaml:"app_name"`
+
+	Token      string `yaml:"token"`
+	Index      string `yaml:"index"`
+	Sourcetype string `yaml:"sourcetype"`
+	Source     string `yaml:"source"`
+	Pipeline   string `yaml:"pipeline"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	APIKey     string `yaml:"api_key"`
+
+	BatchSize     int    `yaml:"batch_size"`
+	BatchBytes    int    `yaml:"batch_bytes"`
+	FlushInterval string `yaml:"flush_interval"`
+	DeadLetter    string `yaml:"dead_letter"`
+}
+
+// LoadConfig reads a sink configuration from the YAML file at the path argument
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// parseDuration parses an optional duration setting
+func parseDuration(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(str)
+}
+
+// Build opens every configured sink and returns a Router over them
+func (c Config) Build() (*Router, error) {
+	var routes []Route
+	for i, sc := range c.Sinks {
+		sink, err := sc.build()
+		if err != nil {
+			NewRouter(routes...).Close()
+			return nil, fmt.Errorf("sink %d (%s): %w", i, sc.Type, err)
+		}
+		route := Route{Sink: sink, Tags: sc.Tags}
+		if sc.MinLevel != "" {
+			if route.MinLevel = types.ToLevel(sc.MinLevel); route.MinLevel == types.UnknownLevel {
+				sink.Close()
+				NewRouter(routes...).Close()
+				return nil, fmt.Errorf("sink %d (%s): unknown level %q", i, sc.Type, sc.MinLevel)
+			}
+		}
+		routes = append(routes, route)
+	}
+	return NewRouter(routes...), nil
+}
+
+// build opens the sink of the configuration
+func (sc SinkConfig) build() (OutputSink, error) {
+	format := singe.JSONFormat
+	if sc.Format != "" {
+		var err error
+		if format, err = singe.ParseFormat(sc.Format); err != nil {
+			return nil, err
+		}
+	}
+	timeout, err := parseDuration(sc.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sc.Type {
+	case "stdout":
+		return NewStdoutSink(format), nil
+	case "file":
+		if sc.Path == "" {
+			return nil, fmt.Errorf("missing path")
+		}
+		return NewFileSink(FileConfig{
+			Path:       sc.Path,
+			MaxBytes:   sc.MaxBytes,
+			MaxBackups: sc.MaxBackups,
+			Format:     format,
+		})
+	case "webhook":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("missing url")
+		}
+		backoff, err := sc.backoff()
+		if err != nil {
+			return nil, err
+		}
+		return NewWebhookSink(WebhookConfig{
+			URL:     sc.URL,
+			Headers: sc.Headers,
+			Timeout: timeout,
+			Backoff: backoff,
+			Format:  format,
+		}), nil
+	case "syslog":
+		if sc.Address == "" {
+			return nil, fmt.Errorf("missing address")
+		}
+		return NewSyslogSink(SyslogConfig{
+			Network:  sc.Network,
+			Address:  sc.Address,
+			Facility: sc.Facility,
+			AppName:  sc.AppName,
+			Format:   format,
+			Timeout:  timeout,
+		})
+	case "splunk_hec":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("missing url")
+		}
+		backoff, err := sc.backoff()
+		if err != nil {
+			return nil, err
+		}
+		batch, err := sc.batch()
+		if err != nil {
+			return nil, err
+		}
+		return NewSplunkHECSink(SplunkHECConfig{
+			URL:        sc.URL,
+			Token:      sc.Token,
+			Index:      sc.Index,
+			Sourcetype: sc.Sourcetype,
+			Source:     sc.Source,
+			Format:     format,
+			Timeout:    timeout,
+			Batch:      batch,
+			Backoff:    backoff,
+		}), nil
+	case "elasticsearch":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("missing url")
+		}
+		backoff, err := sc.backoff()
+		if err != nil {
+			return nil, err
+		}
+		batch, err := sc.batch()
+		if err != nil {
+			return nil, err
+		}
+		return NewElasticsearchSink(ElasticsearchConfig{
+			URL:      sc.URL,
+			Index:    sc.Index,
+			Pipeline: sc.Pipeline,
+			Username: sc.Username,
+			Password: sc.Password,
+			APIKey:   sc.APIKey,
+			Format:   format,
+			Timeout:  timeout,
+			Batch:    batch,
+			Backoff:  backoff,
+		})
+	}
+	return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+}
+
+// backoff returns the retry settings of an HTTP sink
+func (sc SinkConfig) backoff() (Backoff, error) {
+	initial, err := parseDuration(sc.Backoff)
+	if err != nil {
+		return Backoff{}, err
+	}
+	max, err := parseDuration(sc.MaxBackoff)
+	if err != nil {
+		return Backoff{}, err
+	}
+	return Backoff{MaxRetries: sc.MaxRetries, Initial: initial, Max: max}, nil
+}
+
+// batch returns the batching settings of a bulk sink
+func (sc SinkConfig) batch() (BatchConfig, error) {
+	interval, err := parseDuration(sc.FlushInterval)
+	if err != nil {
+		return BatchConfig{}, err
+	}
+	return BatchConfig{
+		MaxEvents:      sc.BatchSize,
+		MaxBytes:       sc.BatchBytes,
+		FlushInterval:  interval,
+		DeadLetterPath: sc.DeadLetter,
+	}, nil
+}
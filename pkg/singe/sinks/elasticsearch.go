@@ -0,0 +1,174 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// ElasticsearchConfig configures an Elasticsearch bulk API sink
+type ElasticsearchConfig struct {
+	// URL is the cluster base URL, e.g. https://elastic.example.com:9200
+	URL string
+	// Index is the index or data stream that documents are created in
+	Index    string
+	Pipeline string
+	Username string
+	Password string
+	APIKey   string
+	Format   singe.Format
+	Timeout  time.Duration
+	Batch    BatchConfig
+	Backoff  Backoff
+	Client   *http.Client
+}
+
+// bulkResponse is the subset of a _bulk response needed to find failed items
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]bulkResponseItemResult `json:"items"`
+}
+
+type bulkResponseItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// ElasticsearchSink sends batches of output messages to the Elasticsearch _bulk API
+type ElasticsearchSink struct {
+	config   ElasticsearchConfig
+	endpoint string
+	action   []byte
+	client   *http.Client
+	batch    *batcher
+}
+
+// NewElasticsearchSink returns an ElasticsearchSink for the configuration
+func NewElasticsearchSink(config ElasticsearchConfig) (*ElasticsearchSink, error) {
+	if config.Index == "" {
+		return nil, fmt.Errorf("missing index")
+	}
+	endpoint := strings.TrimRight(config.URL, "/") + "/_bulk"
+	if config.Pipeline != "" {
+		endpoint += "?" + url.Values{"pipeline": {config.Pipeline}}.Encode()
+	}
+	// Create actions work for both indices and data streams
+	action, err := json.Marshal(map[string]interface{}{
+		"create": map[string]string{"_index": config.Index},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &ElasticsearchSink{
+		config:   config,
+		endpoint: endpoint,
+		action:   append(action, '\n'),
+		client:   newHTTPClient(config.Client, config.Timeout),
+	}
+	s.batch = newBatcher(config.Batch, s.send)
+	return s, nil
+}
+
+// Write implements OutputSink, buffering one bulk create action per encoded document
+func (s *ElasticsearchSink) Write(msg singe.OutputMessage) error {
+	encoded, err := s.config.Format.Encode(msg)
+	if err != nil {
+		return err
+	}
+	var entries [][]byte
+	for _, doc := range bytes.Split(encoded, []byte("\n")) {
+		entry := make([]byte, 0, len(s.action)+len(doc)+1)
+		entry = append(entry, s.action...)
+		entry = append(entry, doc...)
+		entries = append(entries, append(entry, '\n'))
+	}
+	return s.batch.add(entries...)
+}
+
+// send posts a batch of bulk actions
+// Whole requests are retried on 429 and 5xx responses, and only the failed items of partially successful requests
+// are retried when their own status is 429 or 5xx; the other failed items are returned for dead-lettering
+func (s *ElasticsearchSink) send(entries [][]byte) ([][]byte, error) {
+	pending := entries
+	var rejected [][]byte
+	err := s.config.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(bytes.Join(pending, nil)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		if s.config.APIKey != "" {
+			req.Header.Set("Authorization", "ApiKey "+s.config.APIKey)
+		} else if s.config.Username != "" {
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+		resp, err := doRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return checkResponse(resp)
+		}
+
+		var result bulkResponse
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		// Without an item per action the delivered actions are unknown, so the whole batch failed
+		if len(result.Items) != len(pending) {
+			return fmt.Errorf("bulk response has %d items for %d actions", len(result.Items), len(pending))
+		}
+		if !result.Errors {
+			pending = nil
+			return nil
+		}
+		var retry [][]byte
+		var lastErr string
+		for i, item := range result.Items {
+			for _, res := range item {
+				if res.Status >= 200 && res.Status < 300 {
+					continue
+				}
+				lastErr = string(res.Error)
+				if res.Status == http.StatusTooManyRequests || res.Status >= 500 {
+					retry = append(retry, pending[i])
+				} else {
+					rejected = append(rejected, pending[i])
+				}
+			}
+		}
+		pending = retry
+		if len(pending) > 0 {
+			return ErrStatus{Code: http.StatusTooManyRequests, Body: lastErr}
+		}
+		return nil
+	})
+	failed := append(rejected, pending...)
+	if err == nil && len(rejected) > 0 {
+		err = fmt.Errorf("%d bulk items rejected", len(rejected))
+	}
+	if err != nil && len(failed) == 0 {
+		failed = entries
+	}
+	return failed, err
+}
+
+// Flush sends the buffered actions immediately
+func (s *ElasticsearchSink) Flush() error {
+	return s.batch.flush()
+}
+
+// Close implements OutputSink, sending the remaining buffered actions
+func (s *ElasticsearchSink) Close() error {
+	err := s.batch.close()
+	s.client.CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,110 @@
+package sinks
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// FileConfig configures a rotating JSON lines file sink
+type FileConfig struct {
+	Path string
+	// MaxBytes is the size at which the file is rotated, 0 disables rotation
+	MaxBytes int64
+	// MaxBackups is the number of rotated files kept as Path.1 to Path.N, 0 discards rotated output
+	MaxBackups int
+	Format     singe.Format
+}
+
+// FileSink appends output messages as lines to a file, rotating it by size
+type FileSink struct {
+	mu     sync.Mutex
+	config FileConfig
+	file   *os.File
+	size   int64
+}
+
+// NewFileSink opens or creates the file of the configuration for appending
+func NewFileSink(config FileConfig) (*FileSink, error) {
+	s := &FileSink{config: config}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the sink's file for appending and records its current size
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups by one, moves the current file to Path.1 and reopens an empty file
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	path := s.config.Path
+	if s.config.MaxBackups <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Write implements OutputSink
+func (s *FileSink) Write(msg singe.OutputMessage) error {
+	line, err := encodeLine(msg, s.config.Format)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	// A line is never split across files, so a file may only exceed MaxBytes by holding a single oversized line
+	if s.config.MaxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.config.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close implements OutputSink
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,135 @@
+package sinks
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default retry settings of HTTP sinks
+const (
+	DefaultMaxRetries     = 3
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// Backoff configures how HTTP sinks retry failed requests
+// Zero values are replaced by the package defaults, a negative MaxRetries disables retries
+type Backoff struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// Initial is the delay before the first retry, doubled on each further retry
+	Initial time.Duration
+	// Max caps the delay between retries, including delays requested by the server
+	Max time.Duration
+}
+
+// withDefaults returns the backoff with unset values replaced by the package defaults
+func (b Backoff) withDefaults() Backoff {
+	if b.MaxRetries == 0 {
+		b.MaxRetries = DefaultMaxRetries
+	}
+	if b.MaxRetries < 0 {
+		b.MaxRetries = 0
+	}
+	if b.Initial <= 0 {
+		b.Initial = DefaultInitialBackoff
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultMaxBackoff
+	}
+	return b
+}
+
+// ErrStatus is returned by HTTP sinks for a response status that indicates failure
+type ErrStatus struct {
+	Code int
+	Body string
+	// retryAfter is the delay requested by the server through the Retry-After header
+	retryAfter time.Duration
+}
+
+func (e ErrStatus) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d: %s", e.Code, e.Body)
+}
+
+// Retryable returns whether the status indicates a transient failure (429 or 5xx)
+func (e ErrStatus) Retryable() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// errTransport is the error of an HTTP request that got no response, which is retried
+type errTransport struct {
+	err error
+}
+
+func (e errTransport) Error() string {
+	return e.err.Error()
+}
+
+func (e errTransport) Unwrap() error {
+	return e.err
+}
+
+// doRequest sends an HTTP request, marking the errors of requests that got no response as transport errors
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errTransport{err}
+	}
+	return resp, nil
+}
+
+// checkResponse returns an ErrStatus for non 2xx responses and drains the response body
+func checkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := ErrStatus{Code: resp.StatusCode, Body: string(body)}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		err.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
+
+// retry calls send until it succeeds, fails permanently or the retries are exhausted
+// Transport errors and retryable statuses are retried with exponential backoff capped at Max, other errors are permanent
+func (b Backoff) retry(send func() error) error {
+	b = b.withDefaults()
+	delay := b.Initial
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+		wait := delay
+		switch e := err.(type) {
+		case ErrStatus:
+			if !e.Retryable() {
+				return err
+			}
+			if e.retryAfter > wait {
+				wait = e.retryAfter
+			}
+		case errTransport:
+		default:
+			return err
+		}
+		if attempt >= b.MaxRetries {
+			return err
+		}
+		if wait > b.Max {
+			wait = b.Max
+		}
+		time.Sleep(wait)
+		if delay *= 2; delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sinks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// OutputSink forwards the output messages of matching events to a destination
+type OutputSink interface {
+	// Write forwards a single output message
+	Write(msg singe.OutputMessage) error
+	// Close flushes pending output messages and releases the sink's resources
+	Close() error
+}
+
+// SinkErrors collects the errors of several sinks written in one fan-out
+type SinkErrors []error
+
+func (e SinkErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// WriterSink writes each output message as a line encoded in a singe output format
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format singe.Format
+}
+
+// NewWriterSink returns a WriterSink writing to the writer argument
+func NewWriterSink(w io.Writer, format singe.Format) *WriterSink {
+	return &WriterSink{w: w, format: format}
+}
+
+// NewStdoutSink returns a WriterSink writing to standard output
+func NewStdoutSink(format singe.Format) *WriterSink {
+	return NewWriterSink(os.Stdout, format)
+}
+
+// Write implements OutputSink
+func (s *WriterSink) Write(msg singe.OutputMessage) error {
+	line, err := encodeLine(msg, s.format)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close implements OutputSink
+// The underlying writer is owned by the caller and is left open
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// encodeLine returns the output message encoded in the format argument and terminated by a newline
+func encodeLine(msg singe.OutputMessage, format singe.Format) ([]byte, error) {
+	encoded, err := format.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, '\n'), nil
+}
+
+// Route forwards the output messages matched by its conditions to a sink
+// A route without conditions forwards every output message
+type Route struct {
+	Sink OutputSink
+	// MinLevel is the lowest rule level forwarded
+	MinLevel types.Level
+	// Tags are globs of which a rule must match at least one, e.g. "attack.t1003*"
+	Tags []string
+}
+
+// keep returns whether a matching rule satisfies the route's conditions
+func (r Route) keep(rule singe.RuleData) bool {
+	if r.MinLevel != types.UnknownLevel && types.ToLevel(rule.Level) < r.MinLevel {
+		return false
+	}
+	return len(r.Tags) == 0 || tools.MatchGlobs(r.Tags, rule.Tags...)
+}
+
+// Router fans output messages out to every route whose conditions are met by at least one matching rule
+// Each sink receives the output message restricted to the rules that met its route's conditions
+type Router struct {
+	routes []Route
+}
+
+// NewRouter returns a Router over the routes argument
+func NewRouter(routes ...Route) *Router {
+	return &Router{routes: routes}
+}
+
+// Write implements OutputSink
+func (r *Router) Write(msg singe.OutputMessage) error {
+	var errs SinkErrors
+	for i, route := range r.routes {
+		routed, ok := msg.Filter(route.keep)
+		if !ok {
+			continue
+		}
+		if err := route.Sink.Write(routed); err != nil {
+			errs = append(errs, fmt.Errorf("route %d: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Close implements OutputSink, closing every routed sink
+func (r *Router) Close() error {
+	var errs SinkErrors
+	for i, route := range r.routes {
+		if err := route.Sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
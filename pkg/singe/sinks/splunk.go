@@ -0,0 +1,125 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// SplunkHECConfig configures a Splunk HTTP Event Collector sink
+type SplunkHECConfig struct {
+	// URL is the collector base URL, e.g. https://splunk.example.com:8088
+	URL        string
+	Token      string
+	Index      string
+	Sourcetype string
+	Source     string
+	Host       string
+	Format     singe.Format
+	Timeout    time.Duration
+	Batch      BatchConfig
+	Backoff    Backoff
+	Client     *http.Client
+}
+
+// hecEvent is a single event of the HEC JSON event protocol
+type hecEvent struct {
+	Time       float64         `json:"time"`
+	Host       string          `json:"host,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	Sourcetype string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// SplunkHECSink sends batches of output messages to the Splunk HTTP Event Collector
+type SplunkHECSink struct {
+	config   SplunkHECConfig
+	endpoint string
+	client   *http.Client
+	batch    *batcher
+}
+
+// NewSplunkHECSink returns a SplunkHECSink for the configuration
+func NewSplunkHECSink(config SplunkHECConfig) *SplunkHECSink {
+	if config.Sourcetype == "" {
+		config.Sourcetype = "_json"
+	}
+	if config.Source == "" {
+		config.Source = "singe"
+	}
+	if config.Host == "" {
+		config.Host, _ = os.Hostname()
+	}
+	s := &SplunkHECSink{
+		config:   config,
+		endpoint: strings.TrimRight(config.URL, "/") + "/services/collector/event",
+		client:   newHTTPClient(config.Client, config.Timeout),
+	}
+	s.batch = newBatcher(config.Batch, s.send)
+	return s
+}
+
+// Write implements OutputSink, buffering one HEC event per encoded document
+func (s *SplunkHECSink) Write(msg singe.OutputMessage) error {
+	encoded, err := s.config.Format.Encode(msg)
+	if err != nil {
+		return err
+	}
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	var entries [][]byte
+	for _, doc := range bytes.Split(encoded, []byte("\n")) {
+		entry, err := json.Marshal(hecEvent{
+			Time:       now,
+			Host:       s.config.Host,
+			Source:     s.config.Source,
+			Sourcetype: s.config.Sourcetype,
+			Index:      s.config.Index,
+			Event:      json.RawMessage(doc),
+		})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, append(entry, '\n'))
+	}
+	return s.batch.add(entries...)
+}
+
+// send posts a batch of HEC events, retrying 429 and 5xx responses
+func (s *SplunkHECSink) send(entries [][]byte) ([][]byte, error) {
+	body := bytes.Join(entries, nil)
+	err := s.config.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Splunk "+s.config.Token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := doRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		return checkResponse(resp)
+	})
+	if err != nil {
+		return entries, err
+	}
+	return nil, nil
+}
+
+// Flush sends the buffered events immediately
+func (s *SplunkHECSink) Flush() error {
+	return s.batch.flush()
+}
+
+// Close implements OutputSink, sending the remaining buffered events
+func (s *SplunkHECSink) Close() error {
+	err := s.batch.close()
+	s.client.CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,166 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// Syslog facility of forwarded alerts unless configured
+const DefaultSyslogFacility = 16 // local0
+
+// SyslogConfig configures an RFC 5424 syslog forwarding sink
+type SyslogConfig struct {
+	// Network is "udp" or "tcp"
+	Network  string
+	Address  string
+	Facility int
+	AppName  string
+	Hostname string
+	Format   singe.Format
+	Timeout  time.Duration
+}
+
+// SyslogSink forwards output messages as RFC 5424 syslog messages
+// Messages are sent as single datagrams over UDP and with octet counting framing (RFC 6587) over TCP
+type SyslogSink struct {
+	mu     sync.Mutex
+	config SyslogConfig
+	conn   net.Conn
+}
+
+// NewSyslogSink connects to the syslog server of the configuration
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Facility == 0 {
+		config.Facility = DefaultSyslogFacility
+	}
+	if config.AppName == "" {
+		config.AppName = "singe"
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	s := &SyslogSink{config: config}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect (re)establishes the connection to the syslog server
+func (s *SyslogSink) connect() error {
+	conn, err := net.DialTimeout(s.config.Network, s.config.Address, s.config.Timeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// syslogSeverity maps Sigma levels to syslog severities
+func syslogSeverity(level types.Level) int {
+	switch level {
+	case types.CriticalLevel:
+		return 2
+	case types.HighLevel:
+		return 3
+	case types.MediumLevel:
+		return 4
+	case types.LowLevel:
+		return 5
+	}
+	return 6
+}
+
+// highestLevel returns the most severe rule level of an output message
+func highestLevel(msg singe.OutputMessage) types.Level {
+	highest := types.UnknownLevel
+	for _, rule := range msg.Result.MatchList {
+		if level := types.ToLevel(rule.Level); level > highest {
+			highest = level
+		}
+	}
+	return highest
+}
+
+// frame returns a single RFC 5424 message, framed for the sink's transport
+func (s *SyslogSink) frame(severity int, timestamp time.Time, payload []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d sigma - ",
+		s.config.Facility*8+severity,
+		timestamp.Format(time.RFC3339Nano),
+		nilValue(s.config.Hostname),
+		nilValue(s.config.AppName),
+		os.Getpid(),
+	)
+	buf.Write(payload)
+	if s.config.Network == "udp" {
+		return buf.Bytes()
+	}
+	return append([]byte(fmt.Sprintf("%d ", buf.Len())), buf.Bytes()...)
+}
+
+// nilValue returns the RFC 5424 NILVALUE for empty header fields
+func nilValue(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+// Write implements OutputSink, sending one syslog message per encoded document
+func (s *SyslogSink) Write(msg singe.OutputMessage) error {
+	encoded, err := s.config.Format.Encode(msg)
+	if err != nil {
+		return err
+	}
+	severity := syslogSeverity(highestLevel(msg))
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return net.ErrClosed
+	}
+	for _, doc := range bytes.Split(encoded, []byte("\n")) {
+		frame := s.frame(severity, now, doc)
+		if _, err := s.conn.Write(frame); err != nil {
+			// Stream connections are re-established once, e.g. after a server restart
+			if s.config.Network == "udp" {
+				return err
+			}
+			s.conn.Close()
+			if err := s.connect(); err != nil {
+				return err
+			}
+			if _, err := s.conn.Write(frame); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close implements OutputSink
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package sinks
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// WebhookConfig configures an HTTP webhook sink
+type WebhookConfig struct {
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+	Backoff Backoff
+	Format  singe.Format
+	// Client overrides the HTTP client built from Timeout
+	Client *http.Client
+}
+
+// WebhookSink POSTs each output message to an HTTP endpoint
+type WebhookSink struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink for the configuration
+func NewWebhookSink(config WebhookConfig) *WebhookSink {
+	return &WebhookSink{config: config, client: newHTTPClient(config.Client, config.Timeout)}
+}
+
+// newHTTPClient returns the client argument, or a client with the timeout argument
+func newHTTPClient(client *http.Client, timeout time.Duration) *http.Client {
+	if client != nil {
+		return client
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// contentType returns the media type of a body encoded in the format argument
+// Formats other than JSON write one document per matching rule, newline delimited
+func contentType(format singe.Format) string {
+	if format == singe.JSONFormat {
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
+// Write implements OutputSink, retrying transport errors, 429 and 5xx responses
+func (s *WebhookSink) Write(msg singe.OutputMessage) error {
+	body, err := s.config.Format.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return s.config.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType(s.config.Format))
+		for key, val := range s.config.Headers {
+			req.Header.Set(key, val)
+		}
+		resp, err := doRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		return checkResponse(resp)
+	})
+}
+
+// Close implements OutputSink
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,79 @@
+package singe
+
+import (
+	"io"
+	"io/fs"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+)
+
+// RuleSource lists the Sigma rule files loaded into an engine
+type RuleSource func() ([]tools.RuleFile, error)
+
+// FromDir returns the rule source of the .yml and .yaml files in an OS directory tree
+func FromDir(path string) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return tools.DirFiles(path)
+	}
+}
+
+// FromFS returns the rule source of the .yml and .yaml files under the root directory of a file system, e.g. an embed.FS
+func FromFS(fsys fs.FS, root string) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return tools.FSFiles(fsys, root)
+	}
+}
+
+// FromBytes returns the rule source of a single in-memory rule, identified by the name argument in load reports
+func FromBytes(name string, data []byte) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return []tools.RuleFile{tools.BytesFile(name, data)}, nil
+	}
+}
+
+// FromReader returns the rule source of a single rule read from the reader argument when the engine is created
+func FromReader(name string, r io.Reader) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		file, err := tools.ReaderFile(name, r)
+		if err != nil {
+			return nil, err
+		}
+		return []tools.RuleFile{file}, nil
+	}
+}
+
+// FromTar returns the rule source of a tar archive read from the reader argument, which may be gzip compressed
+func FromTar(r io.Reader) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return tools.TarFiles(r)
+	}
+}
+
+// FromZip returns the rule source of a zip archive
+func FromZip(r io.ReaderAt, size int64) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return tools.ZipFiles(r, size)
+	}
+}
+
+// FromArchive returns the rule source of a rule pack archive file, a zip file or a tar file that may be gzip compressed
+func FromArchive(path string) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		return tools.ArchiveFiles(path)
+	}
+}
+
+// Sources returns the rule source of the rules of every source argument
+func Sources(sources ...RuleSource) RuleSource {
+	return func() ([]tools.RuleFile, error) {
+		var files []tools.RuleFile
+		for _, source := range sources {
+			sourceFiles, err := source()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sourceFiles...)
+		}
+		return files, nil
+	}
+}
@@ -0,0 +1,268 @@
+package singe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	yaml "gopkg.in/yaml.v2"
+
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+)
+
+// STIX format identifiers
+const (
+	STIXVersion = "2.1"
+	// stixNamespace is the namespace of deterministic STIX identifiers, so the same rule keeps its indicator ID across batches
+	stixNamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+	stixTimestamp = "2006-01-02T15:04:05.000Z"
+)
+
+type stixExternalReference struct {
+	SourceName string `json:"source_name"`
+	ExternalID string `json:"external_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+type stixKillChainPhase struct {
+	KillChainName string `json:"kill_chain_name"`
+	PhaseName     string `json:"phase_name"`
+}
+
+// stixObject holds the fields of the STIX domain and relationship objects written by STIXWriter
+type stixObject struct {
+	Type               string                  `json:"type"`
+	SpecVersion        string                  `json:"spec_version"`
+	ID                 string                  `json:"id"`
+	Created            string                  `json:"created"`
+	Modified           string                  `json:"modified"`
+	Name               string                  `json:"name,omitempty"`
+	Description        string                  `json:"description,omitempty"`
+	IndicatorTypes     []string                `json:"indicator_types,omitempty"`
+	Pattern            string                  `json:"pattern,omitempty"`
+	PatternType        string                  `json:"pattern_type,omitempty"`
+	ValidFrom          string                  `json:"valid_from,omitempty"`
+	Labels             []string                `json:"labels,omitempty"`
+	KillChainPhases    []stixKillChainPhase    `json:"kill_chain_phases,omitempty"`
+	ExternalReferences []stixExternalReference `json:"external_references,omitempty"`
+	RelationshipType   string                  `json:"relationship_type,omitempty"`
+	SourceRef          string                  `json:"source_ref,omitempty"`
+	TargetRef          string                  `json:"target_ref,omitempty"`
+	FirstSeen          string                  `json:"first_seen,omitempty"`
+	LastSeen           string                  `json:"last_seen,omitempty"`
+	Count              int                     `json:"count,omitempty"`
+	SightingOfRef      string                  `json:"sighting_of_ref,omitempty"`
+}
+
+type stixBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []stixObject `json:"objects"`
+}
+
+// stixSighting accumulates the matches of one rule within a batch
+type stixSighting struct {
+	indicator string
+	first     time.Time
+	last      time.Time
+	count     int
+}
+
+// STIXWriter collects the matches of a batch into a STIX 2.1 bundle of indicators, attack patterns and sightings
+type STIXWriter struct {
+	created    time.Time
+	objects    []stixObject
+	indicators map[string]string
+	patterns   map[string]bool
+	sightings  map[string]*stixSighting
+	matrix     *attack.Matrix
+	engine     SigmaEngine
+}
+
+// stixID returns the deterministic STIX identifier of an object of the type argument
+func stixID(objectType string, name string) string {
+	return objectType + "--" + tools.NewNameUUID(stixNamespace, objectType+":"+name)
+}
+
+// NewSTIXWriter returns a STIXWriter with one sigma indicator per rule loaded in the engine
+func NewSTIXWriter(s SigmaEngine) (*STIXWriter, error) {
+	w := &STIXWriter{
+		created:    time.Now().UTC(),
+		indicators: make(map[string]string),
+		patterns:   make(map[string]bool),
+		sightings:  make(map[string]*stixSighting),
+		matrix:     s.matrix,
+		engine:     s,
+	}
+	for _, rule := range s.Rules() {
+		if _, err := w.addIndicator(rule); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// indicatorPattern returns the sigma pattern of a rule, its YAML as written or as merged from a rule collection
+// Rules unknown to the engine, such as matches of other engines, are re-encoded from their parsed form, which lacks
+// the attributes that the Sigma rule type drops
+func (w *STIXWriter) indicatorPattern(rule *sigma.RuleHandle) (string, error) {
+	if data, ok := w.engine.RuleDocument(rule.ID); ok {
+		return string(data), nil
+	}
+	data, err := yaml.Marshal(rule.Rule)
+	if err != nil {
+		return "", fmt.Errorf("encoding rule %s: %w", rule.ID, err)
+	}
+	return string(data), nil
+}
+
+// addIndicator appends the indicator of a Sigma rule and the attack patterns of its ATT&CK tags, if not already present
+func (w *STIXWriter) addIndicator(rule *sigma.RuleHandle) (string, error) {
+	if id, ok := w.indicators[rule.ID]; ok {
+		return id, nil
+	}
+	timestamp := w.created.Format(stixTimestamp)
+	pattern, err := w.indicatorPattern(rule)
+	if err != nil {
+		return "", err
+	}
+	indicator := stixObject{
+		Type:           "indicator",
+		SpecVersion:    STIXVersion,
+		ID:             stixID("indicator", rule.ID),
+		Created:        timestamp,
+		Modified:       timestamp,
+		Name:           rule.Title,
+		Description:    rule.Description,
+		IndicatorTypes: []string{"malicious-activity"},
+		Pattern:        pattern,
+		PatternType:    "sigma",
+		ValidFrom:      timestamp,
+		Labels:         rule.Tags,
+		ExternalReferences: []stixExternalReference{
+			{SourceName: "sigma", ExternalID: rule.ID},
+		},
+	}
+	for _, ref := range rule.References {
+		indicator.ExternalReferences = append(indicator.ExternalReferences, stixExternalReference{SourceName: "reference", URL: ref})
+	}
+
+	tags := w.matrix.Enrich(attack.ParseTags(rule.Tags))
+	for _, tag := range tags {
+		if tag.Kind == attack.Tactic {
+			indicator.KillChainPhases = append(indicator.KillChainPhases, stixKillChainPhase{
+				KillChainName: "mitre-attack",
+				// Tactic names are normalized with underscores, the ATT&CK kill chain writes them hyphenated
+				PhaseName: strings.Replace(tag.Tactics[0], "_", "-", -1),
+			})
+		}
+	}
+	w.indicators[rule.ID] = indicator.ID
+	w.objects = append(w.objects, indicator)
+
+	for _, tag := range tags {
+		if tag.Kind != attack.Technique && tag.Kind != attack.SubTechnique {
+			continue
+		}
+		patternID := stixID("attack-pattern", tag.ID)
+		if !w.patterns[patternID] {
+			w.patterns[patternID] = true
+			name := tag.Name
+			if name == "" {
+				name = tag.ID
+			}
+			w.objects = append(w.objects, stixObject{
+				Type:        "attack-pattern",
+				SpecVersion: STIXVersion,
+				ID:          patternID,
+				Created:     timestamp,
+				Modified:    timestamp,
+				Name:        name,
+				ExternalReferences: []stixExternalReference{
+					{SourceName: "mitre-attack", ExternalID: tag.ID, URL: tag.URL},
+				},
+			})
+		}
+		w.objects = append(w.objects, stixObject{
+			Type:             "relationship",
+			SpecVersion:      STIXVersion,
+			ID:               stixID("relationship", indicator.ID+"/"+patternID),
+			Created:          timestamp,
+			Modified:         timestamp,
+			RelationshipType: "indicates",
+			SourceRef:        indicator.ID,
+			TargetRef:        patternID,
+		})
+	}
+	return indicator.ID, nil
+}
+
+// Add records a sighting of each matching rule of the output message, seen at the time argument
+func (w *STIXWriter) Add(msg OutputMessage, seen time.Time) error {
+	seen = seen.UTC()
+	for _, rule := range msg.Result.MatchList {
+		sighting, ok := w.sightings[rule.ID]
+		if !ok {
+			// Matches from rules unknown to the engine still need an indicator to reference
+			indicator, err := w.addIndicator(&sigma.RuleHandle{Rule: sigma.Rule{
+				ID:          rule.ID,
+				Title:       rule.Title,
+				Description: rule.Description,
+				References:  rule.References,
+				Tags:        rule.Tags,
+			}})
+			if err != nil {
+				return err
+			}
+			sighting = &stixSighting{indicator: indicator, first: seen, last: seen}
+			w.sightings[rule.ID] = sighting
+		}
+		if seen.Before(sighting.first) {
+			sighting.first = seen
+		}
+		if seen.After(sighting.last) {
+			sighting.last = seen
+		}
+		sighting.count++
+	}
+	return nil
+}
+
+// Write encodes the collected indicators and sightings as a STIX bundle
+func (w *STIXWriter) Write(out io.Writer) error {
+	timestamp := time.Now().UTC().Format(stixTimestamp)
+	objects := append([]stixObject{}, w.objects...)
+
+	ids := make([]string, 0, len(w.sightings))
+	for id := range w.sightings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sighting := w.sightings[id]
+		objects = append(objects, stixObject{
+			Type:          "sighting",
+			SpecVersion:   STIXVersion,
+			ID:            "sighting--" + tools.NewUUID(),
+			Created:       timestamp,
+			Modified:      timestamp,
+			FirstSeen:     sighting.first.Format(stixTimestamp),
+			LastSeen:      sighting.last.Format(stixTimestamp),
+			Count:         sighting.count,
+			SightingOfRef: sighting.indicator,
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stixBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + tools.NewUUID(),
+		Objects: objects,
+	})
+}
@@ -0,0 +1,114 @@
+package suppress
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// RuleAttribute is the custom Sigma rule attribute that holds a rule's own suppression policy, e.g.
+//
+//	suppression:
+//	  fields: [Computer, User]
+//	  window: 15m
+//	  limit: 3
+const RuleAttribute = "suppression"
+
+// Policy configures the suppression of repeated matches of a rule
+type Policy struct {
+	// Fields are the event fields, in dot notation, that are combined with the rule ID into the suppression key
+	Fields []string `yaml:"fields"`
+	// Window is the time during which matches with the same key are counted, starting at the first one
+	Window time.Duration `yaml:"window"`
+	// Limit is the number of matches with the same key forwarded per window, 1 unless set
+	Limit int `yaml:"limit"`
+}
+
+// validate checks a policy and sets its default limit
+func (p *Policy) validate() error {
+	if p.Window <= 0 {
+		return fmt.Errorf("missing window")
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("negative limit %d", p.Limit)
+	}
+	if p.Limit == 0 {
+		p.Limit = 1
+	}
+	return nil
+}
+
+// Config is the YAML configuration of suppression policies, e.g.
+//
+//	default:
+//	  fields: [Computer]
+//	  window: 10m
+//	rules:
+//	  e28a5a99-da44-436d-b7a0-2afc20a5f413:
+//	    fields: [Computer, User]
+//	    window: 1h
+//	    limit: 5
+//
+// Policies configured by rule ID take precedence over the rule attribute, which takes precedence over the default
+type Config struct {
+	// Default applies to rules without a policy of their own, no suppression unless set
+	Default *Policy           `yaml:"default"`
+	Rules   map[string]Policy `yaml:"rules"`
+}
+
+// LoadConfig reads a suppression configuration from the YAML file at the path argument
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validate checks every policy of the configuration
+func (c *Config) validate() error {
+	if c.Default != nil {
+		if err := c.Default.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for id, policy := range c.Rules {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", id, err)
+		}
+		c.Rules[id] = policy
+	}
+	return nil
+}
+
+// rulePolicies returns the policies set through the rule attribute, keyed by rule ID
+// The sigma library drops unknown attributes, so the attribute is read from the YAML document of each rule, which for
+// a rule of a collection is merged with the global documents of the collection
+func rulePolicies(engine singe.SigmaEngine) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+	for _, rule := range engine.Rules() {
+		data, ok := engine.RuleDocument(rule.ID)
+		if !ok {
+			continue
+		}
+		var doc struct {
+			Suppression *Policy `yaml:"suppression"`
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil || doc.Suppression == nil {
+			continue
+		}
+		if err := doc.Suppression.validate(); err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %s: %w", rule.Path, rule.ID, RuleAttribute, err)
+		}
+		policies[rule.ID] = *doc.Suppression
+	}
+	return policies, nil
+}
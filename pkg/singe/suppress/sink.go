@@ -0,0 +1,97 @@
+package suppress
+
+import (
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	sinks "github.com/Adversary-Informed-Defense/singe/pkg/singe/sinks"
+)
+
+// expireInterval is how often a Sink checks for closed windows
+const expireInterval = time.Second
+
+// Sink is an OutputSink that suppresses repeated matches before forwarding output messages to another sink,
+// and forwards the summary of each closed window that suppressed matches
+type Sink struct {
+	mu         sync.Mutex
+	next       sinks.OutputSink
+	suppressor *Suppressor
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSink returns a Sink forwarding to the next argument
+func NewSink(next sinks.OutputSink, suppressor *Suppressor) *Sink {
+	s := &Sink{
+		next:       next,
+		suppressor: suppressor,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run forwards the summaries of expired windows until the sink is closed
+func (s *Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := s.writeSummaries(s.suppressor.Expire(now)); err != nil {
+				logrus.Infof("Error writing suppression summary: %s", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// writeSummaries forwards summaries as output messages
+func (s *Sink) writeSummaries(summaries []Summary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs sinks.SinkErrors
+	for _, summary := range summaries {
+		if err := s.next.Write(summary.Message()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Write implements OutputSink
+func (s *Sink) Write(msg singe.OutputMessage) error {
+	msg, ok := s.suppressor.Apply(msg, time.Now())
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next.Write(msg)
+}
+
+// Close implements OutputSink, forwarding the summaries of the open windows before closing the next sink
+func (s *Sink) Close() error {
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+	close(s.stop)
+	<-s.done
+	err := s.writeSummaries(s.suppressor.Flush())
+	if closeErr := s.next.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+package suppress
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+)
+
+// Summary reports the matches of a suppression key during a closed window
+type Summary struct {
+	Rule singe.RuleData
+	// Key holds the values of the policy's fields, empty for fields missing from the event
+	Key   map[string]string
+	First time.Time
+	Last  time.Time
+	// Count is the number of matches in the window, of which Suppressed were not forwarded
+	Count      int
+	Suppressed int
+	Window     time.Duration
+}
+
+// Message returns the summary as an output message of the summarized rule, to be written to the same outputs as the matches
+func (s Summary) Message() singe.OutputMessage {
+	key := make(map[string]interface{}, len(s.Key))
+	for field, val := range s.Key {
+		key[field] = val
+	}
+	event := sigma.DynamicMap{
+		"suppression": map[string]interface{}{
+			"rule_id":    s.Rule.ID,
+			"key":        key,
+			"first":      s.First.UTC().Format(time.RFC3339Nano),
+			"last":       s.Last.UTC().Format(time.RFC3339Nano),
+			"count":      s.Count,
+			"suppressed": s.Suppressed,
+			"window":     s.Window.String(),
+		},
+	}
+	return singe.NewOutputMessage(event, []singe.Rule{{RuleData: s.Rule}})
+}
+
+// window counts the matches of a suppression key
+type window struct {
+	rule       singe.RuleData
+	key        map[string]string
+	policy     Policy
+	first      time.Time
+	last       time.Time
+	count      int
+	suppressed int
+}
+
+// summary returns the summary of the window
+func (w *window) summary() Summary {
+	return Summary{
+		Rule:       w.rule,
+		Key:        w.key,
+		First:      w.first,
+		Last:       w.last,
+		Count:      w.count,
+		Suppressed: w.suppressed,
+		Window:     w.policy.Window,
+	}
+}
+
+// Suppressor drops repeated matches of a rule and suppression key beyond the limit of the rule's policy within its window
+type Suppressor struct {
+	mu         sync.Mutex
+	config     Config
+	attributes map[string]Policy
+	windows    map[string]*window
+	// closed holds the summaries of windows closed by Apply until they are returned by Expire
+	closed []Summary
+}
+
+// NewSuppressor returns a Suppressor for the configuration and the suppression attributes of the engine's rules
+func NewSuppressor(config Config, engine singe.SigmaEngine) (*Suppressor, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	attributes, err := rulePolicies(engine)
+	if err != nil {
+		return nil, err
+	}
+	return &Suppressor{
+		config:     config,
+		attributes: attributes,
+		windows:    make(map[string]*window),
+	}, nil
+}
+
+// Reload replaces the suppression attributes with those of the engine's rules, e.g. after a ReloadableEngine swapped in
+// new rules; open windows are kept
+// The previous attributes are kept if a rule attribute is invalid
+func (s *Suppressor) Reload(engine singe.SigmaEngine) error {
+	attributes, err := rulePolicies(engine)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = attributes
+	return nil
+}
+
+// policy returns the suppression policy of a rule, if any
+func (s *Suppressor) policy(id string) (Policy, bool) {
+	if policy, ok := s.config.Rules[id]; ok {
+		return policy, true
+	}
+	if policy, ok := s.attributes[id]; ok {
+		return policy, true
+	}
+	if s.config.Default != nil {
+		return *s.config.Default, true
+	}
+	return Policy{}, false
+}
+
+// Apply returns the output message restricted to the matching rules that are not suppressed at the time argument,
+// and whether any rule was kept
+func (s *Suppressor) Apply(msg singe.OutputMessage, at time.Time) (singe.OutputMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return msg.Filter(func(rule singe.RuleData) bool {
+		policy, ok := s.policy(rule.ID)
+		if !ok {
+			return true
+		}
+		id, key := suppressionKey(rule.ID, policy.Fields, msg.Event)
+		w, ok := s.windows[id]
+		if ok && at.Sub(w.first) >= policy.Window {
+			s.close(id, w)
+			ok = false
+		}
+		if !ok {
+			w = &window{rule: rule, key: key, policy: policy, first: at}
+			s.windows[id] = w
+		}
+		w.last = at
+		w.count++
+		if w.count > policy.Limit {
+			w.suppressed++
+			return false
+		}
+		return true
+	})
+}
+
+// close removes a window, keeping its summary if any match was suppressed
+func (s *Suppressor) close(id string, w *window) {
+	delete(s.windows, id)
+	if w.suppressed > 0 {
+		s.closed = append(s.closed, w.summary())
+	}
+}
+
+// Expire closes the windows that ended by the time argument, returning the summaries of the closed windows
+// that suppressed at least one match
+func (s *Suppressor) Expire(at time.Time) []Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, w := range s.windows {
+		if at.Sub(w.first) >= w.policy.Window {
+			s.close(id, w)
+		}
+	}
+	return s.drain()
+}
+
+// Flush closes every window, returning the summaries of the windows that suppressed at least one match
+func (s *Suppressor) Flush() []Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, w := range s.windows {
+		s.close(id, w)
+	}
+	return s.drain()
+}
+
+// drain returns the summaries of closed windows in order of their first match
+func (s *Suppressor) drain() []Summary {
+	closed := s.closed
+	s.closed = nil
+	sort.SliceStable(closed, func(i, j int) bool {
+		return closed[i].First.Before(closed[j].First)
+	})
+	return closed
+}
+
+// suppressionKey returns the window key of a rule and the values of the policy's fields in an event
+func suppressionKey(ruleID string, fields []string, event sigma.Event) (string, map[string]string) {
+	key := make(map[string]string, len(fields))
+	parts := make([]string, 0, len(fields)+1)
+	parts = append(parts, ruleID)
+	for _, field := range fields {
+		var str string
+		if event != nil {
+			if val, ok := event.Select(field); ok && val != nil {
+				str = fmt.Sprint(val)
+			}
+		}
+		key[field] = str
+		parts = append(parts, str)
+	}
+	return strings.Join(parts, "\x00"), key
+}
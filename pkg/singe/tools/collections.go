@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Actions of the documents of a multi-document Sigma rule collection
+const (
+	// GlobalAction documents are merged into every following rule until reset
+	GlobalAction = "global"
+	// ResetAction documents discard the global documents read so far
+	ResetAction = "reset"
+	// RepeatAction documents are merged into the previous rule to produce a new rule
+	RepeatAction = "repeat"
+)
+
+// ParseRules returns the Sigma rules of the content of a rule file, which is either a single rule or a multi-document
+// rule collection
+// Rules of a collection that inherit the ID of a previous rule of the collection are given an ID derived from it,
+// see SubRuleID, and rules without an ID are given one derived from their content, see ContentID
+func ParseRules(data []byte) ([]sigma.Rule, error) {
+	parsed, err := ParseRuleFile(data)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]sigma.Rule, len(parsed))
+	for i, rule := range parsed {
+		rules[i] = rule.Rule
+	}
+	return rules, nil
+}
+
+// ParsedRule is a rule parsed from a rule file along with the attributes that the sigma library drops
+type ParsedRule struct {
+	sigma.Rule
+	Related []RelatedRule
+	// GeneratedID is set for rules without an ID of their own
+	GeneratedID bool
+	// Data is the YAML of the rule, the content of a single rule file or the merged document of a rule of a collection
+	Data []byte
+}
+
+// parseRule parses the YAML of a single rule, generating its ID if it has none
+func parseRule(data []byte) (ParsedRule, error) {
+	rule := ParsedRule{Data: data}
+	if err := yaml.Unmarshal(data, &rule.Rule); err != nil {
+		return rule, err
+	}
+	var attributes struct {
+		Related []RelatedRule `yaml:"related"`
+	}
+	if err := yaml.Unmarshal(data, &attributes); err != nil {
+		return rule, fmt.Errorf("related: %w", err)
+	}
+	rule.Related = attributes.Related
+	if rule.ID == "" {
+		rule.ID, rule.GeneratedID = ContentID(data), true
+	}
+	return rule, nil
+}
+
+// ParseRuleFile returns the rules of the content of a rule file with their related attribute, see ParseRules
+func ParseRuleFile(data []byte) ([]ParsedRule, error) {
+	docs, err := yamlDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) <= 1 {
+		if len(docs) == 1 && docs[0]["action"] != nil {
+			return nil, fmt.Errorf("rule collection holds no rule")
+		}
+		rule, err := parseRule(data)
+		if err != nil {
+			return nil, err
+		}
+		return []ParsedRule{rule}, nil
+	}
+
+	var rules []ParsedRule
+	var global, previous map[interface{}]interface{}
+	ids := make(map[string]bool)
+	for i, doc := range docs {
+		action, _ := doc["action"].(string)
+		delete(doc, "action")
+		var merged map[interface{}]interface{}
+		switch action {
+		case GlobalAction:
+			global = mergeYAML(global, doc)
+			continue
+		case ResetAction:
+			global = nil
+			continue
+		case RepeatAction:
+			if previous == nil {
+				return nil, fmt.Errorf("document %d: %s action without a previous rule", i+1, RepeatAction)
+			}
+			merged = mergeYAML(previous, doc)
+		case "":
+			merged = mergeYAML(global, doc)
+		default:
+			return nil, fmt.Errorf("document %d: unknown action %q", i+1, action)
+		}
+		encoded, err := yaml.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		rule, err := parseRule(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		if ids[rule.ID] {
+			rule.ID = SubRuleID(rule.ID, len(rules)+1)
+		}
+		ids[rule.ID] = true
+		rules = append(rules, rule)
+		previous = merged
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("rule collection holds no rule")
+	}
+	return rules, nil
+}
+
+// yamlDocuments decodes the non-empty documents of a YAML stream as maps
+func yamlDocuments(data []byte) ([]map[interface{}]interface{}, error) {
+	var docs []map[interface{}]interface{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[interface{}]interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+// mergeYAML returns a deep copy of the base map with the values of the update map merged in
+// Nested maps are merged recursively, other values of the update map replace those of the base map
+func mergeYAML(base map[interface{}]interface{}, update map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(base)+len(update))
+	for key, val := range base {
+		if nested, ok := val.(map[interface{}]interface{}); ok {
+			val = mergeYAML(nested, nil)
+		}
+		merged[key] = val
+	}
+	for key, val := range update {
+		nested, ok := val.(map[interface{}]interface{})
+		if baseNested, baseOk := merged[key].(map[interface{}]interface{}); ok && baseOk {
+			val = mergeYAML(baseNested, nested)
+		} else if ok {
+			val = mergeYAML(nested, nil)
+		}
+		merged[key] = val
+	}
+	return merged
+}
+
+// SubRuleID returns the deterministic ID of the part-th rule of a collection that inherits the ID argument
+// UUIDs are derived as name-based (version 5) UUIDs in the namespace of the inherited ID, other IDs get a part suffix
+func SubRuleID(id string, part int) string {
+	namespace, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	if err != nil || len(namespace) != 16 {
+		return id + "-" + strconv.Itoa(part)
+	}
+	return NewNameUUID(id, strconv.Itoa(part))
+}
+
+// contentNamespace is the namespace UUID of the IDs generated from rule content
+const contentNamespace = "00000000-0000-0000-0000-000000000000"
+
+// ContentID returns the deterministic ID of a rule without one, a name-based (version 5) UUID of the rule's YAML
+// The ID changes whenever the rule is edited, so rules should be given an ID of their own
+func ContentID(data []byte) string {
+	return NewNameUUID(contentNamespace, string(bytes.TrimSpace(data)))
+}
@@ -1,14 +1,11 @@
 package tools
 
 import (
-	"bytes"
-	"io/ioutil"
 	"strings"
 
 	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
 	logrus "github.com/sirupsen/logrus"
 	objx "github.com/stretchr/objx"
-	yaml "gopkg.in/yaml.v2"
 )
 
 // mapToKey returns the matching key for the value argument in the mapping
@@ -31,6 +28,30 @@ func mapToVal(keyStr string, mapping objx.Map) (interface{}, bool) {
 	return nil, false
 }
 
+// editSelection uses the mapping argument to replace the field names of a selection map
+func editSelection(selection map[interface{}]interface{}, mapping objx.Map) map[interface{}]interface{} {
+	newSelection := make(map[interface{}]interface{})
+	for selKey, selVal := range selection {
+		name, ok := selKey.(string)
+		if !ok {
+			newSelection[selKey] = selVal
+			continue
+		}
+		// Split is necessary for parsing field modifiers (contains, ends with, etc.)
+		splitKey := strings.SplitN(name, "|", 2)
+		// Fields missing from the mapping keep their name
+		field := splitKey[0]
+		if k, ok := mapToVal(field, mapping); ok {
+			if str, ok := k.(string); ok {
+				field = str
+			}
+		}
+		newKey := strings.Join(append([]string{field}, splitKey[1:]...), "|")
+		newSelection[newKey] = selVal
+	}
+	return newSelection
+}
+
 // editRule uses the mapping argument to replace the field names of the Sigma rule's identifiers
 func editRule(rule sigma.Rule, mapping objx.Map) sigma.Rule {
 	newDetection := sigma.Detection{}
@@ -39,87 +60,47 @@ func editRule(rule sigma.Rule, mapping objx.Map) sigma.Rule {
 		// The "condition" field of the rule does not need to be changed
 		if key == "condition" {
 			newDetection[key] = val
-		} else {
-			switch val.(type) {
-			case []interface{}:
-				newDetection[key] = val
-			case map[interface{}]interface{}:
-				// Replace the selection field with the corresponding Winlog field path
-				newSelection := make(map[interface{}]interface{})
-				for selKey, selVal := range val.(map[interface{}]interface{}) {
-					// Split is necessary for parsing field modifiers (contains, ends with, etc.)
-					splitKey := strings.SplitN(selKey.(string), "|", 2)
-					k, _ := mapToVal(splitKey[0], mapping) // Only need to check boolean value to see if edit occurred
-					newKey := strings.Join(append([]string{k.(string)}, splitKey[1:]...), "|")
-					newSelection[newKey] = selVal
+			continue
+		}
+		switch v := val.(type) {
+		case []interface{}:
+			// Lists hold keywords, which are kept, or selection maps that are OR'ed together
+			newList := make([]interface{}, len(v))
+			for i, item := range v {
+				if selection, ok := item.(map[interface{}]interface{}); ok {
+					newList[i] = editSelection(selection, mapping)
+				} else {
+					newList[i] = item
 				}
-				newDetection[key] = newSelection
-			default:
-				logrus.Infof("Error unknown detection element type")
-				panic("Error")
 			}
+			newDetection[key] = newList
+		case map[interface{}]interface{}:
+			// Replace the selection field with the corresponding Winlog field path
+			newDetection[key] = editSelection(v, mapping)
+		default:
+			// Scalars such as timeframe and single keywords have no field names
+			newDetection[key] = val
 		}
 	}
 	rule.Detection = newDetection
 	return rule
 }
 
-// AddMappedRules edits the identifier field names of each Sigma rule in a directory and adds them to a ruleset
+// AddMappedRules edits the identifier field names of each Sigma rule in a directory tree and adds them to a ruleset
+// Rule files are selected and counted in the ruleset totals as by LoadRules
 func AddMappedRules(ruleset *sigma.Ruleset, path string, mapping objx.Map) error {
-	files, err := ioutil.ReadDir(path)
+	files, err := DirFiles(path)
 	if err != nil {
 		logrus.Infof("Error opening directory: %s", err)
 		return err
 	}
-	// Wrap rule creation
-	for _, fileName := range files {
-		// Read in rule
-		file, err := ioutil.ReadFile(path + fileName.Name())
-		if err != nil {
-			logrus.Infof("Error openning file: %s", err)
-			continue
-		}
-		var rule sigma.Rule
-		if err := yaml.Unmarshal(file, &rule); err != nil {
-			logrus.Infof("Error unmarshalling YAML file: %s", err)
-			continue
-		}
-
-		// If the rule is successfully read in, increment the number of processed rules
-		ruleset.Total++
-
-		// Map rule fields
-		rule = editRule(rule, mapping)
-
-		// Create RuleHandle struct
-		ruleHandle := sigma.RuleHandle{
-			Path: path + fileName.Name(),
-			Rule: rule,
-			Multipart: func() bool {
-				return !bytes.HasPrefix(file, []byte("---")) && bytes.Contains(file, []byte("---"))
-			}(),
-		}
-		if ruleHandle.Multipart {
-			ruleset.Unsupported++
-			continue
-		}
-
-		// Make Tree struct
-		tree, err := sigma.NewTree(ruleHandle)
-		if err != nil {
-			switch err.(type) {
-			case sigma.ErrUnsupportedToken, *sigma.ErrUnsupportedToken:
-				ruleset.Unsupported++
-			default:
-				ruleset.Failed++
-			}
-			continue
-		}
-
-		// Append Tree to Ruleset struct
-		ruleset.Rules = append(ruleset.Rules, tree)
-		ruleset.Ok++
-	}
-
+	mapped, _ := loadRuleFiles(files, RuleFilter{}, func(rule sigma.Rule) sigma.Rule {
+		return editRule(rule, mapping)
+	})
+	ruleset.Rules = append(ruleset.Rules, mapped.Rules...)
+	ruleset.Total += mapped.Total
+	ruleset.Ok += mapped.Ok
+	ruleset.Failed += mapped.Failed
+	ruleset.Unsupported += mapped.Unsupported
 	return nil
 }
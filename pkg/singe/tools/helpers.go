@@ -1,13 +1,16 @@
 package tools
 
 import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime"
 	"strings"
 
-	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
 	logrus "github.com/sirupsen/logrus"
 	objx "github.com/stretchr/objx"
 )
@@ -79,35 +82,23 @@ func ErrorHandler(e chan error) {
 	}
 }
 
+// DeleteRulesetsEnv is the environment variable listing the rule files or directories excluded from loading, one per line
+const DeleteRulesetsEnv = "DELETE_RULESETS"
+
 // DeleteRules removes rule files defined by user in DELETE_RULESETS
+//
+// Deprecated: DeleteRules deletes the rule directories from disk. Load the engine with the singe.ExcludeEnvRulesets
+// option to skip the same paths without deleting them, or list them under exclude.paths of a rule selection file.
 func DeleteRules() {
-	omitRuleSets := GetListEnvVar("DELETE_RULESETS")
+	omitRuleSets := GetListEnvVar(DeleteRulesetsEnv)
 	if omitRuleSets != nil {
-		logrus.Infof("Removing rule sets: %s", omitRuleSets)
+		logrus.Warnf("DeleteRules is deprecated, removing rule sets from disk: %s", omitRuleSets)
 	}
 	for _, omitRuleSet := range omitRuleSets {
 		os.RemoveAll(omitRuleSet)
 	}
 }
 
-// LoadRules creates a Sigma ruleset containing the rules from the directory path
-func LoadRules(path string) *sigma.Ruleset {
-	ruleset, err := sigma.NewRuleset(sigma.Config{
-		Directory: []string{path},
-	})
-	if err != nil {
-		logrus.Errorf("Failed to load sigma rules: %s", err)
-	}
-	logrus.Infof(
-		"Found %d files, %d ok, %d failed, %d unsupported",
-		ruleset.Total,
-		ruleset.Ok,
-		ruleset.Failed,
-		ruleset.Unsupported,
-	)
-	return ruleset
-}
-
 // RemoveStringDuplicates returns the string array argument with all duplicate values removed
 func RemoveStringDuplicates(arr []string) []string {
 	keys := make(map[string]bool)
@@ -120,3 +111,29 @@ func RemoveStringDuplicates(arr []string) []string {
 	}
 	return output
 }
+
+// NewUUID returns a random (version 4) UUID string
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// NewNameUUID returns the name-based (version 5) UUID string of the name argument within the namespace UUID
+func NewNameUUID(namespace string, name string) string {
+	ns, err := hex.DecodeString(strings.Replace(namespace, "-", "", -1))
+	if err != nil || len(ns) != 16 {
+		panic(fmt.Sprintf("invalid namespace UUID: %s", namespace))
+	}
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+)
+
+// Types of the relation of a rule to a rule listed in its related attribute
+const (
+	DerivedRelation   = "derived"
+	ObsoletesRelation = "obsoletes"
+	MergedRelation    = "merged"
+	RenamedRelation   = "renamed"
+	SimilarRelation   = "similar"
+)
+
+// RelatedRule is an entry of the related attribute of a Sigma rule, e.g.
+//
+//	related:
+//	  - id: 0d0bd5a4-7dce-4b0b-9a0e-0f3a8f1d6c21
+//	    type: obsoletes
+type RelatedRule struct {
+	ID   string `yaml:"id" json:"id"`
+	Type string `yaml:"type" json:"type"`
+}
+
+// Replaces returns whether the relation makes the related rule obsolete, so that it is not loaded along with the rule
+func (r RelatedRule) Replaces() bool {
+	switch strings.ToLower(r.Type) {
+	case ObsoletesRelation, MergedRelation, RenamedRelation:
+		return true
+	}
+	return false
+}
+
+// DuplicateIDError is the error of a rule with the ID of a rule loaded before it
+type DuplicateIDError struct {
+	ID string
+	// Path is the file of the rule loaded first
+	Path string
+}
+
+func (e DuplicateIDError) Error() string {
+	return fmt.Sprintf("duplicate rule ID %s, already loaded from %s", e.ID, e.Path)
+}
+
+// loadedRule is the outcome of loading a rule before rule identities are resolved
+type loadedRule struct {
+	tree    *sigma.Tree
+	report  RuleReport
+	related []RelatedRule
+}
+
+// resolveIdentities fails the loaded rules with the ID of a rule loaded before them, then filters the loaded rules
+// replaced by another loaded rule through its related attribute
+func resolveIdentities(rules []loadedRule) {
+	seen := make(map[string]string)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.tree == nil {
+			continue
+		}
+		if path, ok := seen[strings.ToLower(rule.report.ID)]; ok {
+			rule.tree = nil
+			rule.report.Status, rule.report.Err, rule.report.data = FailedStatus, DuplicateIDError{ID: rule.report.ID, Path: path}, nil
+			continue
+		}
+		seen[strings.ToLower(rule.report.ID)] = rule.report.Path
+	}
+
+	replaced := make(map[string]string)
+	for _, rule := range rules {
+		if rule.tree == nil {
+			continue
+		}
+		for _, related := range rule.related {
+			if related.Replaces() && !strings.EqualFold(related.ID, rule.report.ID) {
+				replaced[strings.ToLower(related.ID)] = rule.report.ID
+			}
+		}
+	}
+	for i := range rules {
+		rule := &rules[i]
+		by, ok := replaced[strings.ToLower(rule.report.ID)]
+		if rule.tree == nil || !ok {
+			continue
+		}
+		rule.tree = nil
+		rule.report.Status, rule.report.Reason, rule.report.ReplacedBy, rule.report.data = FilteredStatus, "related", by, nil
+	}
+}
@@ -0,0 +1,399 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	glob "github.com/ryanuber/go-glob"
+	logrus "github.com/sirupsen/logrus"
+
+	detection "github.com/Adversary-Informed-Defense/singe/pkg/singe/detection"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// RuleFilter selects the rules loaded into a ruleset
+// Empty include lists select every rule, string comparisons are case insensitive
+type RuleFilter struct {
+	Statuses        []string
+	ExcludeStatuses []string
+	// MinLevel is the lowest rule level loaded, rules without a known level are excluded once it is set
+	MinLevel types.Level
+	// Tags and ExcludeTags are globs, e.g. "attack.t1003*"; a rule is selected by any matching tag
+	Tags        []string
+	ExcludeTags []string
+	Products    []string
+	Categories  []string
+	IDs         []string
+	ExcludeIDs  []string
+	// Paths and ExcludePaths are globs of rule file paths relative to the loaded directory, e.g. "windows/*"
+	Paths        []string
+	ExcludePaths []string
+	// SkipPaths are rule files or directories that are not loaded, either absolute or relative to the working or loaded directory
+	SkipPaths []string
+}
+
+// MatchGlobs returns whether any value matches any of the glob patterns, ignoring case
+func MatchGlobs(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, val := range values {
+			if glob.Glob(strings.ToLower(pattern), strings.ToLower(val)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsFold checks whether a string slice contains a particular string, ignoring case
+func containsFold(slice []string, str string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, str) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped returns whether a rule file is one of the filter's skipped paths or is under one of them
+// Skipped paths are compared with the path relative to the source root, and with the OS path of directory sources
+func (f RuleFilter) skipped(file RuleFile) bool {
+	abs, absErr := filepath.Abs(file.Path)
+	for _, skip := range f.SkipPaths {
+		rel := strings.TrimPrefix(path.Clean(filepath.ToSlash(skip)), "./")
+		if file.Rel == rel || strings.HasPrefix(file.Rel, rel+"/") {
+			return true
+		}
+		candidate, err := filepath.Abs(skip)
+		if err != nil || absErr != nil {
+			continue
+		}
+		if abs == candidate || strings.HasPrefix(abs, candidate+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathExcluded returns whether the filter excludes a rule file by its path, before it is read
+func (f RuleFilter) pathExcluded(file RuleFile) bool {
+	return len(f.Paths) > 0 && !MatchGlobs(f.Paths, file.Rel) ||
+		MatchGlobs(f.ExcludePaths, file.Rel) ||
+		f.skipped(file)
+}
+
+// exclusion returns the criterion that excludes a parsed rule, or an empty string if the filter selects it
+func (f RuleFilter) exclusion(rule sigma.Rule) string {
+	switch {
+	case len(f.Statuses) > 0 && !containsFold(f.Statuses, rule.Status),
+		containsFold(f.ExcludeStatuses, rule.Status):
+		return "status"
+	case f.MinLevel != types.UnknownLevel && types.ToLevel(rule.Level) < f.MinLevel:
+		return "level"
+	case len(f.Tags) > 0 && !MatchGlobs(f.Tags, rule.Tags...),
+		MatchGlobs(f.ExcludeTags, rule.Tags...):
+		return "tags"
+	case len(f.Products) > 0 && !containsFold(f.Products, rule.Logsource.Product),
+		len(f.Categories) > 0 && !containsFold(f.Categories, rule.Logsource.Category):
+		return "logsource"
+	case len(f.IDs) > 0 && !containsFold(f.IDs, rule.ID),
+		containsFold(f.ExcludeIDs, rule.ID):
+		return "id"
+	}
+	return ""
+}
+
+// LoadStatus represents the enumerated outcomes of loading a rule file
+type LoadStatus int64
+
+const (
+	LoadedStatus LoadStatus = iota
+	FailedStatus
+	UnsupportedStatus
+	FilteredStatus
+)
+
+func (l LoadStatus) String() string {
+	switch l {
+	case LoadedStatus:
+		return "ok"
+	case FailedStatus:
+		return "failed"
+	case UnsupportedStatus:
+		return "unsupported"
+	case FilteredStatus:
+		return "filtered"
+	}
+	return "Unreachable: unknown status"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (l LoadStatus) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// RuleReport is the outcome of loading a single rule, or of a rule file that failed to parse
+type RuleReport struct {
+	Path string `json:"path"`
+	// Part is the position of the rule within a multi-document rule collection starting at 1, 0 for single rule files
+	Part   int        `json:"part,omitempty"`
+	ID     string     `json:"id,omitempty"`
+	Title  string     `json:"title,omitempty"`
+	Status LoadStatus `json:"status"`
+	// Reason is the filter criterion that excluded a filtered rule
+	Reason string `json:"reason,omitempty"`
+	// ReplacedBy is the ID of the loaded rule that obsoletes, renames or merges a rule filtered by the related criterion
+	ReplacedBy string `json:"replaced_by,omitempty"`
+	// GeneratedID is set if the rule has no ID of its own and its ID was derived from its content
+	GeneratedID bool `json:"generated_id,omitempty"`
+	// Err is the read, parse, duplicate ID or unsupported token error of a failed or unsupported rule
+	Err error `json:"-"`
+
+	// data holds the content of a loaded rule file
+	data []byte
+	// document holds the YAML of a loaded rule, see ParsedRule.Data
+	document []byte
+}
+
+// MarshalJSON implements json.Marshaler, encoding the error as a string
+func (r RuleReport) MarshalJSON() ([]byte, error) {
+	type report RuleReport
+	var msg string
+	if r.Err != nil {
+		msg = r.Err.Error()
+	}
+	return json.Marshal(struct {
+		report
+		Error string `json:"error,omitempty"`
+	}{report(r), msg})
+}
+
+// LoadReport lists the outcome of loading each rule of a ruleset
+type LoadReport struct {
+	Rules []RuleReport `json:"rules"`
+	// Files is the number of rule files, Total the number of rules and unparsed files reported
+	Files       int `json:"files"`
+	Total       int `json:"total"`
+	Ok          int `json:"ok"`
+	Failed      int `json:"failed"`
+	Unsupported int `json:"unsupported"`
+	Filtered    int `json:"filtered"`
+
+	// files holds the content of the loaded rule files by path
+	files map[string][]byte
+	// documents holds the YAML of the loaded rules by ID
+	documents map[string][]byte
+}
+
+// add records the outcome of a rule
+func (r *LoadReport) add(rule RuleReport) {
+	r.Rules = append(r.Rules, rule)
+	r.Total++
+	switch rule.Status {
+	case LoadedStatus:
+		r.Ok++
+		if r.files == nil {
+			r.files = make(map[string][]byte)
+			r.documents = make(map[string][]byte)
+		}
+		r.files[rule.Path] = rule.data
+		r.documents[rule.ID] = rule.document
+	case FailedStatus:
+		r.Failed++
+	case UnsupportedStatus:
+		r.Unsupported++
+	case FilteredStatus:
+		r.Filtered++
+	}
+}
+
+// File returns the content of the loaded rule file at the path argument
+func (r LoadReport) File(path string) ([]byte, bool) {
+	data, ok := r.files[path]
+	return data, ok
+}
+
+// Document returns the YAML of the loaded rule with the ID argument, which for a rule of a collection is its document
+// merged with the global documents of the collection
+func (r LoadReport) Document(id string) ([]byte, bool) {
+	data, ok := r.documents[id]
+	return data, ok
+}
+
+// Errors returns the reports of the rule files that failed to load
+func (r LoadReport) Errors() []RuleReport {
+	var failed []RuleReport
+	for _, rule := range r.Rules {
+		if rule.Status == FailedStatus {
+			failed = append(failed, rule)
+		}
+	}
+	return failed
+}
+
+// Err returns an error listing the rule files that failed to load, if any
+func (r LoadReport) Err() error {
+	failed := r.Errors()
+	if len(failed) == 0 {
+		return nil
+	}
+	return LoadError{Rules: failed}
+}
+
+// summary returns the load summary line of the report
+func (r LoadReport) summary() string {
+	found := fmt.Sprintf("%d files", r.Files)
+	if r.Total != r.Files {
+		found = fmt.Sprintf("%d files with %d rules", r.Files, r.Total)
+	}
+	line := fmt.Sprintf("Found %s, %d ok, %d failed, %d unsupported", found, r.Ok, r.Failed, r.Unsupported)
+	if r.Filtered == 0 {
+		return line
+	}
+	counts := make(map[string]int)
+	for _, rule := range r.Rules {
+		if rule.Status == FilteredStatus {
+			counts[rule.Reason]++
+		}
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason, count := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d by %s", count, reason))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("%s, %d filtered (%s)", line, r.Filtered, strings.Join(reasons, ", "))
+}
+
+// LoadError is the error of a ruleset with rule files that failed to load
+type LoadError struct {
+	Rules []RuleReport
+}
+
+func (e LoadError) Error() string {
+	msgs := make([]string, len(e.Rules))
+	for i, rule := range e.Rules {
+		if rule.Part > 0 {
+			msgs[i] = fmt.Sprintf("%s (rule %d): %s", rule.Path, rule.Part, rule.Err)
+			continue
+		}
+		msgs[i] = fmt.Sprintf("%s: %s", rule.Path, rule.Err)
+	}
+	return fmt.Sprintf("%d rules failed to load: %s", len(e.Rules), strings.Join(msgs, "; "))
+}
+
+// LoadRules creates a Sigma ruleset containing the rules from the directory path
+// Directory errors are logged and leave the ruleset empty
+func LoadRules(path string) *sigma.Ruleset {
+	ruleset, _, err := LoadFilteredRules(path, RuleFilter{})
+	if err != nil {
+		logrus.Errorf("Failed to load sigma rules: %s", err)
+	}
+	return ruleset
+}
+
+// LoadFilteredRules creates a Sigma ruleset containing the rules from the directory path that are selected by the filter,
+// and reports the outcome of each rule file
+// An error is returned when the directory cannot be walked, e.g. if it is missing or not readable, along with an empty ruleset;
+// rule files that fail to load are only reported
+func LoadFilteredRules(path string, filter RuleFilter) (*sigma.Ruleset, LoadReport, error) {
+	files, err := DirFiles(path)
+	if err != nil {
+		return &sigma.Ruleset{}, LoadReport{}, err
+	}
+	ruleset, report := LoadRuleFiles(files, filter)
+	return ruleset, report, nil
+}
+
+// LoadRuleFiles creates a Sigma ruleset containing the rule files selected by the filter, and reports the outcome of each one
+func LoadRuleFiles(files []RuleFile, filter RuleFilter) (*sigma.Ruleset, LoadReport) {
+	return loadRuleFiles(files, filter, nil)
+}
+
+// loadRuleFiles loads the rule files selected by the filter, editing each selected rule with the edit argument if set
+// Rules with the ID of a rule loaded before them fail, and rules replaced by another loaded rule are filtered
+func loadRuleFiles(files []RuleFile, filter RuleFilter, edit func(sigma.Rule) sigma.Rule) (*sigma.Ruleset, LoadReport) {
+	var rules []loadedRule
+	var report LoadReport
+	for _, file := range files {
+		rules = append(rules, loadRules(file, filter, edit)...)
+		report.Files++
+	}
+	resolveIdentities(rules)
+	ruleset := &sigma.Ruleset{}
+	for _, rule := range rules {
+		report.add(rule.report)
+		if rule.tree != nil {
+			ruleset.Rules = append(ruleset.Rules, rule.tree)
+		}
+	}
+	ruleset.Total = report.Total
+	ruleset.Ok = report.Ok
+	ruleset.Failed = report.Failed
+	ruleset.Unsupported = report.Unsupported
+	logrus.Info(report.summary())
+	return ruleset, report
+}
+
+// loadRules parses the rules of a rule file, returning the outcome of each rule
+func loadRules(file RuleFile, filter RuleFilter, edit func(sigma.Rule) sigma.Rule) []loadedRule {
+	report := RuleReport{Path: file.Path}
+	// Excluded paths are not read, so that they may hold files that fail to parse
+	if filter.pathExcluded(file) {
+		report.Status, report.Reason = FilteredStatus, "path"
+		return []loadedRule{{report: report}}
+	}
+	data, err := file.Read()
+	if err != nil {
+		report.Status, report.Err = FailedStatus, err
+		return []loadedRule{{report: report}}
+	}
+	rules, err := ParseRuleFile(data)
+	if err != nil {
+		report.Status, report.Err = FailedStatus, err
+		return []loadedRule{{report: report}}
+	}
+	loaded := make([]loadedRule, len(rules))
+	for i, rule := range rules {
+		loaded[i].report = RuleReport{Path: file.Path, GeneratedID: rule.GeneratedID}
+		if len(rules) > 1 {
+			loaded[i].report.Part = i + 1
+		}
+		loaded[i].tree = loadRule(rule.Rule, data, filter, edit, &loaded[i].report)
+		if loaded[i].tree != nil {
+			loaded[i].report.document = rule.Data
+		}
+		loaded[i].related = rule.Related
+	}
+	return loaded
+}
+
+// loadRule builds the tree of a parsed rule of the file content argument, the tree is nil unless the rule is loaded
+// Filters apply to the rule as written, before it is edited
+func loadRule(rule sigma.Rule, data []byte, filter RuleFilter, edit func(sigma.Rule) sigma.Rule, report *RuleReport) *sigma.Tree {
+	report.ID, report.Title = rule.ID, rule.Title
+	if reason := filter.exclusion(rule); reason != "" {
+		report.Status, report.Reason = FilteredStatus, reason
+		return nil
+	}
+	if edit != nil {
+		rule = edit(rule)
+	}
+	tree, err := detection.NewTree(sigma.RuleHandle{Path: report.Path, Rule: rule})
+	if err != nil {
+		report.Err = err
+		var unsupported sigma.ErrUnsupportedToken
+		if errors.As(err, &unsupported) {
+			report.Status = UnsupportedStatus
+		} else {
+			report.Status = FailedStatus
+		}
+		return nil
+	}
+	report.Status, report.data = LoadedStatus, data
+	return tree
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RuleFile is a rule file listed by a rule source
+type RuleFile struct {
+	// Path identifies the file in load reports and rule handles
+	Path string
+	// Rel is the slash separated path of the file relative to the root of its source, matched by path filters
+	Rel string
+	// Read returns the content of the file; files are only read once they pass the path filters
+	Read func() ([]byte, error)
+	// Stat, if set, returns the info of the file, whose size and modification time tell reloads whether to read it again
+	Stat func() (os.FileInfo, error)
+}
+
+// SampleSuffix ends the base name of the sidecar files that hold the test samples of a rule file, e.g.
+// proc_creation_win_whoami.tests.yml for proc_creation_win_whoami.yml; they are not loaded as rules
+const SampleSuffix = ".tests"
+
+// isRuleFile returns whether a file name has a YAML extension and is not a test sample sidecar file
+func isRuleFile(name string) bool {
+	lower := strings.ToLower(name)
+	ext := path.Ext(lower)
+	return (ext == ".yml" || ext == ".yaml") && !strings.HasSuffix(strings.TrimSuffix(lower, ext), SampleSuffix)
+}
+
+// staticRead returns a RuleFile reader of in-memory content
+func staticRead(data []byte) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return data, nil
+	}
+}
+
+// DirFiles lists the rule files in an OS directory tree
+func DirFiles(root string) ([]RuleFile, error) {
+	var files []RuleFile
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isRuleFile(file) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || rel == "." {
+			rel = filepath.Base(file)
+		}
+		files = append(files, RuleFile{
+			Path: file,
+			Rel:  filepath.ToSlash(rel),
+			Read: func() ([]byte, error) {
+				return ioutil.ReadFile(file)
+			},
+			Stat: func() (os.FileInfo, error) {
+				return os.Stat(file)
+			},
+		})
+		return nil
+	})
+	return files, err
+}
+
+// FSFiles lists the rule files under the root directory of a file system, such as an embed.FS
+func FSFiles(fsys fs.FS, root string) ([]RuleFile, error) {
+	var files []RuleFile
+	err := fs.WalkDir(fsys, root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isRuleFile(file) {
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(file, root), "/")
+		if root == "." || rel == "" {
+			rel = file
+		}
+		files = append(files, RuleFile{
+			Path: file,
+			Rel:  rel,
+			Read: func() ([]byte, error) {
+				return fs.ReadFile(fsys, file)
+			},
+			Stat: func() (os.FileInfo, error) {
+				return fs.Stat(fsys, file)
+			},
+		})
+		return nil
+	})
+	return files, err
+}
+
+// BytesFile returns a rule file of in-memory YAML content, identified by the name argument
+func BytesFile(name string, data []byte) RuleFile {
+	return RuleFile{Path: name, Rel: name, Read: staticRead(data)}
+}
+
+// ReaderFile reads a rule file from the reader argument, identified by the name argument
+func ReaderFile(name string, r io.Reader) (RuleFile, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return RuleFile{}, err
+	}
+	return BytesFile(name, data), nil
+}
+
+// TarFiles lists the rule files of a tar archive, which may be gzip compressed
+// Entries are paths within the archive and are read into memory
+func TarFiles(r io.Reader) ([]RuleFile, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+	var files []RuleFile
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || !isRuleFile(header.Name) {
+			continue
+		}
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, BytesFile(strings.TrimPrefix(path.Clean(header.Name), "/"), data))
+	}
+}
+
+// ZipFiles lists the rule files of a zip archive
+func ZipFiles(r io.ReaderAt, size int64) ([]RuleFile, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return FSFiles(archive, ".")
+}
+
+// ArchiveFiles lists the rule files of the tar (.tar, .tar.gz, .tgz) or zip (.zip) archive at the path argument
+func ArchiveFiles(file string) ([]RuleFile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(file), ".zip") {
+		return ZipFiles(bytes.NewReader(data), int64(len(data)))
+	}
+	return TarFiles(bytes.NewReader(data))
+}
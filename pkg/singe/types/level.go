@@ -0,0 +1,51 @@
+package types
+
+import "strings"
+
+// Level represents the enumerated Sigma rule levels, ordered by severity
+type Level int64
+
+const (
+	UnknownLevel Level = iota
+	InformationalLevel
+	LowLevel
+	MediumLevel
+	HighLevel
+	CriticalLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case UnknownLevel:
+		return "unknown"
+	case InformationalLevel:
+		return "informational"
+	case LowLevel:
+		return "low"
+	case MediumLevel:
+		return "medium"
+	case HighLevel:
+		return "high"
+	case CriticalLevel:
+		return "critical"
+	}
+	return "Unreachable: unknown level"
+}
+
+// ToLevel returns the enumerated level of a Sigma rule level string
+func ToLevel(str string) Level {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "informational":
+		return InformationalLevel
+	case "low":
+		return LowLevel
+	case "medium":
+		return MediumLevel
+	case "high":
+		return HighLevel
+	case "critical":
+		return CriticalLevel
+	default:
+		return UnknownLevel
+	}
+}
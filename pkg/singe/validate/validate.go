@@ -0,0 +1,359 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	glob "github.com/ryanuber/go-glob"
+	objx "github.com/stretchr/objx"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+)
+
+// Severity represents the enumerated severities of validation findings
+type Severity int64
+
+const (
+	ErrorSeverity Severity = iota
+	WarningSeverity
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ErrorSeverity:
+		return "error"
+	case WarningSeverity:
+		return "warning"
+	}
+	return "Unreachable: unknown severity"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Checks reported in findings
+const (
+	SyntaxCheck    = "syntax"
+	RequiredCheck  = "required"
+	IDCheck        = "id"
+	DuplicateCheck = "duplicate-id"
+	LevelCheck     = "level"
+	StatusCheck    = "status"
+	TagCheck       = "tag"
+	ConditionCheck = "condition"
+	UnusedCheck    = "unused-selection"
+	ModifierCheck  = "modifier"
+	FieldCheck     = "field"
+)
+
+// Finding is a problem found in a rule
+type Finding struct {
+	Path string `json:"path"`
+	// Part is the position of the rule within a multi-document rule collection starting at 1, 0 for single rule files
+	Part     int      `json:"part,omitempty"`
+	ID       string   `json:"id,omitempty"`
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	path := f.Path
+	if f.Part > 0 {
+		path = fmt.Sprintf("%s (rule %d)", path, f.Part)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", path, f.Severity, f.Check, f.Message)
+}
+
+// Options configures the checks of Validate
+type Options struct {
+	// Mapping is the field mapping of the rules, their fields are reported unless they are keys of the mapping when set
+	Mapping objx.Map
+}
+
+// Errors returns the number of findings with the error severity
+func Errors(findings []Finding) int {
+	count := 0
+	for _, finding := range findings {
+		if finding.Severity == ErrorSeverity {
+			count++
+		}
+	}
+	return count
+}
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	tagPattern  = regexp.MustCompile(`^[a-z0-9_-]+\.[a-z0-9._-]+$`)
+	// conditionTokens splits a condition into parentheses, pipes and words
+	conditionTokens = regexp.MustCompile(`[()|]|[^\s()|]+`)
+)
+
+// statuses are the rule statuses of the Sigma specification
+var statuses = map[string]bool{
+	"stable":       true,
+	"test":         true,
+	"experimental": true,
+	"deprecated":   true,
+	"unsupported":  true,
+}
+
+// modifiers are the value modifiers of the Sigma specification
+var modifiers = map[string]bool{
+	"contains":     true,
+	"startswith":   true,
+	"endswith":     true,
+	"all":          true,
+	"base64":       true,
+	"base64offset": true,
+	"utf16le":      true,
+	"utf16be":      true,
+	"utf16":        true,
+	"wide":         true,
+	"windash":      true,
+	"re":           true,
+	"i":            true,
+	"m":            true,
+	"s":            true,
+	"cidr":         true,
+	"lt":           true,
+	"lte":          true,
+	"gt":           true,
+	"gte":          true,
+	"exists":       true,
+	"expand":       true,
+	"fieldref":     true,
+	"cased":        true,
+}
+
+// conditionKeywords are the condition words that are not detection identifiers
+var conditionKeywords = map[string]bool{
+	"and":  true,
+	"or":   true,
+	"not":  true,
+	"of":   true,
+	"all":  true,
+	"them": true,
+	"(":    true,
+	")":    true,
+}
+
+// Validate checks the rules of the rule files against the Sigma specification, returning the findings in file order
+// Rule IDs are also checked for duplicates across the files
+func Validate(files []tools.RuleFile, opts Options) []Finding {
+	var findings []Finding
+	seen := make(map[string]string)
+	for _, file := range files {
+		data, err := file.Read()
+		if err != nil {
+			findings = append(findings, Finding{Path: file.Path, Check: SyntaxCheck, Severity: ErrorSeverity, Message: err.Error()})
+			continue
+		}
+		rules, err := tools.ParseRuleFile(data)
+		if err != nil {
+			findings = append(findings, Finding{Path: file.Path, Check: SyntaxCheck, Severity: ErrorSeverity, Message: err.Error()})
+			continue
+		}
+		for i, rule := range rules {
+			var part int
+			if len(rules) > 1 {
+				part = i + 1
+			}
+			ruleFindings := validateRule(rule, opts)
+			if !rule.GeneratedID {
+				key := strings.ToLower(rule.ID)
+				if first, ok := seen[key]; ok {
+					ruleFindings = append(ruleFindings, Finding{Check: DuplicateCheck, Severity: ErrorSeverity,
+						Message: fmt.Sprintf("ID %s is already used by %s", rule.ID, first)})
+				} else {
+					seen[key] = file.Path
+				}
+			}
+			for _, finding := range ruleFindings {
+				finding.Path, finding.Part, finding.ID = file.Path, part, rule.ID
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// ValidateRule checks a single rule file, see Validate
+func ValidateRule(path string, data []byte, opts Options) []Finding {
+	return Validate([]tools.RuleFile{tools.BytesFile(path, data)}, opts)
+}
+
+// finding returns a finding of a rule with a formatted message
+func finding(check string, severity Severity, format string, args ...interface{}) Finding {
+	return Finding{Check: check, Severity: severity, Message: fmt.Sprintf(format, args...)}
+}
+
+// validateRule checks a parsed rule, the findings are returned without their path and rule
+func validateRule(rule tools.ParsedRule, opts Options) []Finding {
+	var findings []Finding
+	if strings.TrimSpace(rule.Title) == "" {
+		findings = append(findings, finding(RequiredCheck, ErrorSeverity, "missing title"))
+	}
+	if rule.Logsource.Product == "" && rule.Logsource.Category == "" && rule.Logsource.Service == "" {
+		findings = append(findings, finding(RequiredCheck, ErrorSeverity, "missing logsource product, category or service"))
+	}
+
+	switch {
+	case rule.GeneratedID:
+		findings = append(findings, finding(IDCheck, WarningSeverity, "missing id"))
+	case !uuidPattern.MatchString(rule.ID):
+		findings = append(findings, finding(IDCheck, ErrorSeverity, "id %q is not a UUID", rule.ID))
+	}
+
+	switch {
+	case rule.Level == "":
+		findings = append(findings, finding(LevelCheck, WarningSeverity, "missing level"))
+	case types.ToLevel(rule.Level) == types.UnknownLevel:
+		findings = append(findings, finding(LevelCheck, ErrorSeverity, "unknown level %q", rule.Level))
+	}
+
+	switch {
+	case rule.Status == "":
+		findings = append(findings, finding(StatusCheck, WarningSeverity, "missing status"))
+	case !statuses[rule.Status]:
+		findings = append(findings, finding(StatusCheck, ErrorSeverity, "unknown status %q", rule.Status))
+	}
+
+	for _, tag := range rule.Tags {
+		if !tagPattern.MatchString(tag) {
+			findings = append(findings, finding(TagCheck, WarningSeverity, "tag %q is not a lowercase namespace.name", tag))
+		}
+	}
+
+	for _, related := range rule.Related {
+		if !uuidPattern.MatchString(related.ID) {
+			findings = append(findings, finding(IDCheck, ErrorSeverity, "related id %q is not a UUID", related.ID))
+		}
+	}
+
+	return append(findings, validateDetection(rule, opts)...)
+}
+
+// validateDetection checks the condition, selections, modifiers and fields of a rule's detection
+func validateDetection(rule tools.ParsedRule, opts Options) []Finding {
+	if len(rule.Detection) == 0 {
+		return []Finding{finding(RequiredCheck, ErrorSeverity, "missing detection")}
+	}
+	var findings []Finding
+	var identifiers []string
+	for key := range rule.Detection {
+		if key != "condition" && key != "timeframe" {
+			identifiers = append(identifiers, key)
+		}
+	}
+	sort.Strings(identifiers)
+
+	conditions := conditionStrings(rule.Detection["condition"])
+	if len(conditions) == 0 {
+		findings = append(findings, finding(RequiredCheck, ErrorSeverity, "missing condition"))
+	}
+	used := make(map[string]bool)
+	them := false
+	for _, condition := range conditions {
+		for _, token := range conditionTokens.FindAllString(condition, -1) {
+			// Aggregations follow the pipe
+			if token == "|" {
+				break
+			}
+			lower := strings.ToLower(token)
+			if lower == "them" {
+				them = true
+			}
+			if conditionKeywords[lower] || isNumber(token) {
+				continue
+			}
+			matched := false
+			for _, identifier := range identifiers {
+				if identifier == token || strings.Contains(token, "*") && glob.Glob(token, identifier) {
+					used[identifier], matched = true, true
+				}
+			}
+			if !matched {
+				findings = append(findings, finding(ConditionCheck, ErrorSeverity, "condition references undefined identifier %q", token))
+			}
+		}
+	}
+	if len(conditions) > 0 && !them {
+		for _, identifier := range identifiers {
+			if !used[identifier] {
+				findings = append(findings, finding(UnusedCheck, WarningSeverity, "selection %q is not used by the condition", identifier))
+			}
+		}
+	}
+
+	for _, identifier := range identifiers {
+		for _, key := range selectionKeys(rule.Detection[identifier]) {
+			parts := strings.Split(key, "|")
+			for _, modifier := range parts[1:] {
+				if !modifiers[modifier] {
+					findings = append(findings, finding(ModifierCheck, ErrorSeverity, "unknown modifier %q of %q in selection %q", modifier, key, identifier))
+				}
+			}
+			if _, ok := opts.Mapping[parts[0]]; opts.Mapping != nil && parts[0] != "" && !ok {
+				findings = append(findings, finding(FieldCheck, WarningSeverity, "field %q of selection %q is not in the field mapping", parts[0], identifier))
+			}
+		}
+	}
+	return findings
+}
+
+// conditionStrings returns the conditions of a detection, which is either a string or a list of strings
+func conditionStrings(condition interface{}) []string {
+	switch c := condition.(type) {
+	case string:
+		if strings.TrimSpace(c) != "" {
+			return []string{c}
+		}
+	case []interface{}:
+		var conditions []string
+		for _, elem := range c {
+			if str, ok := elem.(string); ok {
+				conditions = append(conditions, str)
+			}
+		}
+		return conditions
+	}
+	return nil
+}
+
+// selectionKeys returns the field keys, with their modifiers, of a selection that is a map or a list of maps
+// Keyword selections have no keys
+func selectionKeys(selection interface{}) []string {
+	var keys []string
+	switch s := selection.(type) {
+	case map[interface{}]interface{}:
+		for key := range s {
+			keys = append(keys, fmt.Sprint(key))
+		}
+	case map[string]interface{}:
+		for key := range s {
+			keys = append(keys, key)
+		}
+	case []interface{}:
+		for _, elem := range s {
+			keys = append(keys, selectionKeys(elem)...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isNumber returns whether a condition token is a count, e.g. in "1 of selection*"
+func isNumber(token string) bool {
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return token != ""
+}
@@ -0,0 +1,163 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestParseTag(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Input  string
+		Output attack.Tag
+		Ok     bool
+	}{
+		{
+			Name:  "Tactic",
+			Input: "attack.defense_evasion",
+			Output: attack.Tag{
+				Tag:     "attack.defense_evasion",
+				Kind:    attack.Tactic,
+				ID:      "TA0005",
+				Name:    "Defense Evasion",
+				URL:     "https://attack.mitre.org/tactics/TA0005/",
+				Tactics: []string{"defense_evasion"},
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Hyphenated Tactic",
+			Input: "attack.privilege-escalation",
+			Output: attack.Tag{
+				Tag:     "attack.privilege-escalation",
+				Kind:    attack.Tactic,
+				ID:      "TA0004",
+				Name:    "Privilege Escalation",
+				URL:     "https://attack.mitre.org/tactics/TA0004/",
+				Tactics: []string{"privilege_escalation"},
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Technique",
+			Input: "attack.t1033",
+			Output: attack.Tag{
+				Tag:  "attack.t1033",
+				Kind: attack.Technique,
+				ID:   "T1033",
+				URL:  "https://attack.mitre.org/techniques/T1033/",
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Sub-Technique",
+			Input: "attack.t1059.001",
+			Output: attack.Tag{
+				Tag:       "attack.t1059.001",
+				Kind:      attack.SubTechnique,
+				ID:        "T1059.001",
+				Technique: "T1059",
+				URL:       "https://attack.mitre.org/techniques/T1059/001/",
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Group",
+			Input: "attack.g0016",
+			Output: attack.Tag{
+				Tag:  "attack.g0016",
+				Kind: attack.Group,
+				ID:   "G0016",
+				URL:  "https://attack.mitre.org/groups/G0016/",
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Software",
+			Input: "attack.s0002",
+			Output: attack.Tag{
+				Tag:  "attack.s0002",
+				Kind: attack.Software,
+				ID:   "S0002",
+				URL:  "https://attack.mitre.org/software/S0002/",
+			},
+			Ok: true,
+		},
+		{
+			Name:  "Non ATT&CK Tag",
+			Input: "car.2016-03-001",
+			Ok:    false,
+		},
+		{
+			Name:  "Unknown ATT&CK Value",
+			Input: "attack.t10",
+			Ok:    false,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			tag, ok := attack.ParseTag(testCase.Input)
+			assert.Equal(t, testCase.Ok, ok)
+			assert.Equal(t, testCase.Output, tag)
+		})
+	}
+}
+
+func TestParseTagsDeduplicates(t *testing.T) {
+	tags := attack.ParseTags([]string{"attack.t1059.001", "attack.execution", "attack.T1059.001", "car.2016-03-001"})
+	require.Len(t, tags, 2)
+	assert.Equal(t, "T1059.001", tags[0].ID)
+	assert.Equal(t, "TA0002", tags[1].ID)
+}
+
+func TestTacticID(t *testing.T) {
+	for _, name := range []string{"command_and_control", "command-and-control", "Command-And-Control"} {
+		id, ok := attack.TacticID(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, "TA0011", id, name)
+	}
+	_, ok := attack.TacticID("t1059")
+	assert.False(t, ok)
+}
+
+func TestMatrixEnrich(t *testing.T) {
+	matrix, err := attack.LoadBundle("testdata/attack/enterprise-attack.json")
+	require.NoError(t, err)
+	assert.Equal(t, 3, matrix.Len())
+
+	tags := matrix.Enrich(attack.ParseTags([]string{"attack.t1059.001", "attack.t1086"}))
+	require.Len(t, tags, 2)
+	assert.Equal(t, "PowerShell", tags[0].Name)
+	assert.Equal(t, "https://attack.mitre.org/techniques/T1059/001", tags[0].URL)
+	assert.Equal(t, []string{"execution"}, tags[0].Tactics)
+	// Deprecated objects are not used for enrichment
+	assert.Equal(t, "", tags[1].Name)
+
+	_, err = attack.ParseBundle([]byte(`{"type": "identity"}`))
+	assert.Error(t, err)
+}
+
+func TestMatchAttackEnrichment(t *testing.T) {
+	matrix, err := attack.LoadBundle("testdata/attack/enterprise-attack.json")
+	require.NoError(t, err)
+	engine := singe.CreateEngine("testdata/rules").WithAttack(matrix)
+
+	output, matched, err := engine.Match(`{"Image": "C:\\Windows\\System32\\whoami.exe"}`, "json")
+	require.NoError(t, err)
+	require.True(t, matched)
+
+	var msg struct {
+		Result singe.EngineResult `json:"sigma"`
+	}
+	require.NoError(t, json.Unmarshal(output, &msg))
+	require.Len(t, msg.Result.AttackList, 2)
+	assert.Equal(t, "TA0007", msg.Result.AttackList[0].ID)
+	assert.Equal(t, "System Owner/User Discovery", msg.Result.AttackList[1].Name)
+	assert.Equal(t, msg.Result.AttackList, msg.Result.MatchList[0].Attack)
+}
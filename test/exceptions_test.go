@@ -0,0 +1,63 @@
+package unit_tests
+
+import (
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	exceptions "github.com/Adversary-Informed-Defense/singe/pkg/singe/exceptions"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestExceptions(t *testing.T) {
+	set, err := exceptions.Load("testdata/exceptions/exceptions.yml")
+	require.NoError(t, err)
+	base := singe.CreateEngine("testdata/rules")
+	engine := base.WithExceptions(set)
+
+	tests := []struct {
+		event string
+		ids   []string
+	}{
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "host": {"name": "WS1"}}`, []string{"e28a5a99-da44-436d-b7a0-2afc20a5f413"}},
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "host": {"name": "JUMP02"}}`, nil},
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "User": "svc_inventory"}`, nil},
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "ParentImage": "C:\\Program Files\\Inventory\\agent.exe"}`, nil},
+		// Exceptions only apply to their own rule
+		{`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "powershell.exe -enc SQBFAFgA", "User": "svc_backup"}`, []string{"e28a5a99-da44-436d-b7a0-2afc20a5f413"}},
+		{`{"CommandLine": "powershell.exe -enc SQBFAFgA", "User": "svc_inventory"}`, []string{"ca2092a1-c273-4878-9b4b-0d60115bf5ea"}},
+	}
+	for _, tt := range tests {
+		msg, matched, err := engine.Evaluate(tt.event, "json")
+		require.NoError(t, err)
+		assert.Equal(t, len(tt.ids) > 0, matched, tt.event)
+		assert.Equal(t, tt.ids, msg.Result.IDList, tt.event)
+	}
+
+	// The engine the exceptions were added to is left unchanged
+	_, matched, err := base.Evaluate(`{"Image": "C:\\Windows\\System32\\whoami.exe", "host": {"name": "JUMP02"}}`, "json")
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	reports := set.Report()
+	require.Len(t, reports, 3)
+	assert.Equal(t, exceptions.Report{Rule: "e28a5a99-da44-436d-b7a0-2afc20a5f413", Description: "Login scripts of the jump hosts", Suppressed: 1}, reports[0])
+	assert.EqualValues(t, 2, reports[1].Suppressed)
+	assert.EqualValues(t, 1, reports[2].Suppressed)
+}
+
+func TestParseExceptions(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"missing rule", "exceptions:\n  - filter:\n      User: admin\n"},
+		{"missing filter", "exceptions:\n  - rule: e28a5a99-da44-436d-b7a0-2afc20a5f413\n"},
+		{"unknown key", "exceptions:\n  - rule: e28a5a99-da44-436d-b7a0-2afc20a5f413\n    condition: filter\n"},
+		{"invalid filter", "exceptions:\n  - rule: e28a5a99-da44-436d-b7a0-2afc20a5f413\n    filter: 42\n"},
+	}
+	for _, tt := range tests {
+		_, err := exceptions.Parse([]byte(tt.doc))
+		assert.Error(t, err, tt.name)
+	}
+}
@@ -0,0 +1,350 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+	logrus "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+const (
+	whoamiID     = "e28a5a99-da44-436d-b7a0-2afc20a5f413"
+	powershellID = "ca2092a1-c273-4878-9b4b-0d60115bf5ea"
+)
+
+// ruleIDs returns the IDs of the rules loaded in an engine
+func ruleIDs(engine singe.SigmaEngine) []string {
+	var ids []string
+	for _, rule := range engine.Rules() {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+func TestLoadOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []singe.LoadOption
+		ids  []string
+	}{
+		{"none", nil, []string{powershellID, whoamiID}},
+		{"status", []singe.LoadOption{singe.IncludeStatus("Test", "stable")}, []string{powershellID}},
+		{"excluded status", []singe.LoadOption{singe.ExcludeStatus("experimental")}, []string{powershellID}},
+		{"level", []singe.LoadOption{singe.MinLevel(types.HighLevel)}, []string{whoamiID}},
+		{"tags", []singe.LoadOption{singe.IncludeTags("attack.t1059*")}, []string{powershellID}},
+		{"excluded tags", []singe.LoadOption{singe.ExcludeTags("car.*")}, []string{powershellID}},
+		{"logsource", []singe.LoadOption{singe.IncludeLogsource("windows", "process_creation")}, []string{powershellID, whoamiID}},
+		{"other logsource", []singe.LoadOption{singe.IncludeLogsource("linux", "")}, nil},
+		{"ids", []singe.LoadOption{singe.IncludeIDs(whoamiID)}, []string{whoamiID}},
+		{"excluded ids", []singe.LoadOption{singe.ExcludeIDs(whoamiID)}, []string{powershellID}},
+		{"paths", []singe.LoadOption{singe.IncludePaths("*whoami*")}, []string{whoamiID}},
+		{"excluded paths", []singe.LoadOption{singe.ExcludePaths("proc_creation_win_powershell_*")}, []string{whoamiID}},
+		{"combined", []singe.LoadOption{singe.ExcludeStatus("experimental"), singe.MinLevel(types.HighLevel)}, nil},
+	}
+	for _, tt := range tests {
+		engine := singe.CreateEngine("testdata/rules", tt.opts...)
+		assert.Equal(t, tt.ids, ruleIDs(engine), tt.name)
+	}
+}
+
+func TestLoadSummary(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	singe.CreateEngine("testdata/rules", singe.MinLevel(types.HighLevel))
+	assert.Equal(t, "Found 2 files, 1 ok, 0 failed, 0 unsupported, 1 filtered (1 by level)", hook.LastEntry().Message)
+}
+
+// copyRules returns a temporary rule directory with the whoami rule under windows/ and the powershell rule and an
+// unparsable file under windows/builtin/
+func copyRules(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "singe-rules")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "windows", "builtin"), 0755))
+	for src, dst := range map[string]string{
+		"proc_creation_win_whoami.yml":             "windows/proc_creation_win_whoami.yml",
+		"proc_creation_win_powershell_encoded.yml": "windows/builtin/proc_creation_win_powershell_encoded.yml",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/rules", src))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, dst), data, 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "windows", "builtin", "broken.yml"), []byte("title: [broken"), 0644))
+	return dir
+}
+
+func TestSelection(t *testing.T) {
+	dir := copyRules(t)
+	defer os.RemoveAll(dir)
+
+	selectionFile := filepath.Join(dir, "selection.yml")
+	require.NoError(t, ioutil.WriteFile(selectionFile, []byte(`include:
+  min_level: low
+  products: [windows]
+exclude:
+  paths: [builtin]
+`), 0644))
+	selection, err := singe.LoadSelection(selectionFile)
+	require.NoError(t, err)
+
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	engine := singe.CreateEngine(filepath.Join(dir, "windows"), singe.SelectRules(selection))
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine))
+	// The skipped directory is neither parsed nor removed
+	assert.Equal(t, "Found 3 files, 1 ok, 0 failed, 0 unsupported, 2 filtered (2 by path)", hook.LastEntry().Message)
+	_, err = os.Stat(filepath.Join(dir, "windows", "builtin", "broken.yml"))
+	assert.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(selectionFile, []byte("exclude:\n  globs: [\"*/proc_creation_win_whoami*\"]\n  ids: ["+powershellID+"]\n"), 0644))
+	selection, err = singe.LoadSelection(selectionFile)
+	require.NoError(t, err)
+	engine = singe.CreateEngine(dir, singe.SelectRules(selection))
+	assert.Empty(t, ruleIDs(engine))
+
+	require.NoError(t, ioutil.WriteFile(selectionFile, []byte("include:\n  min_level: severe\n"), 0644))
+	_, err = singe.LoadSelection(selectionFile)
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(selectionFile, []byte("exclude:\n  directories: [windows]\n"), 0644))
+	_, err = singe.LoadSelection(selectionFile)
+	assert.Error(t, err)
+}
+
+func TestExcludeEnvRulesets(t *testing.T) {
+	dir := copyRules(t)
+	defer os.RemoveAll(dir)
+
+	// DELETE_RULESETS lists one path per line, each terminated by a newline
+	os.Setenv("DELETE_RULESETS", filepath.Join(dir, "windows", "builtin")+"\n")
+	defer os.Unsetenv("DELETE_RULESETS")
+
+	engine := singe.CreateEngine(dir, singe.ExcludeEnvRulesets())
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine))
+	_, err := os.Stat(filepath.Join(dir, "windows", "builtin"))
+	assert.NoError(t, err)
+}
+
+func TestLoadReport(t *testing.T) {
+	report := singe.CreateEngine("testdata/broken", singe.ExcludeIDs("e28a5a99-da44-436d-b7a0-2afc20a5f413")).LoadReport()
+	tests := []struct {
+		path   string
+		id     string
+		status tools.LoadStatus
+		err    string
+	}{
+		{"testdata/broken/aggregation.yml", "0d0bd5a4-7dce-4b0b-9a0e-0f3a8f1d6c21", tools.UnsupportedStatus, "aggregation not supported"},
+		{"testdata/broken/invalid_yaml.yml", "", tools.FailedStatus, "did not find expected ','"},
+		{"testdata/broken/missing_selection.yml", "4f1e9b1e-8c51-4d8f-b1e6-2d2c3c7b5e90", tools.FailedStatus, "missing condition identifier filter"},
+		{"testdata/broken/proc_creation_win_whoami.yml", whoamiID, tools.FilteredStatus, ""},
+	}
+	require.Len(t, report.Rules, len(tests))
+	for i, tt := range tests {
+		rule := report.Rules[i]
+		assert.Equal(t, tt.path, rule.Path)
+		assert.Equal(t, tt.id, rule.ID, tt.path)
+		assert.Equal(t, tt.status, rule.Status, tt.path)
+		if tt.err == "" {
+			assert.NoError(t, rule.Err, tt.path)
+		} else if assert.Error(t, rule.Err, tt.path) {
+			assert.Contains(t, rule.Err.Error(), tt.err, tt.path)
+		}
+	}
+	assert.Equal(t, "id", report.Rules[3].Reason)
+	assert.Equal(t, []int{4, 4, 0, 2, 1, 1}, []int{report.Files, report.Total, report.Ok, report.Failed, report.Unsupported, report.Filtered})
+
+	err := report.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 rules failed to load: testdata/broken/invalid_yaml.yml: ")
+
+	encoded, err := json.Marshal(report.Rules[2])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path": "testdata/broken/missing_selection.yml", "id": "4f1e9b1e-8c51-4d8f-b1e6-2d2c3c7b5e90",
+		"title": "Missing Selection", "status": "failed", "error": "missing condition identifier filter"}`, string(encoded))
+
+	assert.NoError(t, singe.CreateEngine("testdata/rules").LoadReport().Err())
+}
+
+func TestRuleCollections(t *testing.T) {
+	const collectionID = "3b8a3c8e-5f0d-4c39-9a7e-6f1c2d4b8e71"
+	engine, err := singe.NewEngine("testdata/collections", singe.FailOnError())
+	require.NoError(t, err)
+	sessionID := tools.SubRuleID(collectionID, 2)
+	assert.Equal(t, []string{collectionID, sessionID, "7d2f4e1a-9b3c-4a5d-8e6f-0a1b2c3d4e5f", "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"}, ruleIDs(engine))
+
+	tests := []struct {
+		image string
+		id    string
+		title string
+		level string
+	}{
+		// Rules inherit the global document until it is reset
+		{`net.exe`, collectionID, "Account Discovery", "medium"},
+		{`query.exe`, sessionID, "Session Discovery", "high"},
+		{`hostname.exe`, "7d2f4e1a-9b3c-4a5d-8e6f-0a1b2c3d4e5f", "Hostname Discovery", "low"},
+		// Repeated rules inherit the previous rule
+		{`systeminfo.exe`, "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d", "System Information Discovery", "low"},
+		{`whoami.exe`, "", "", ""},
+	}
+	for _, tt := range tests {
+		msg, matched, err := engine.Evaluate(`{"Image": "C:\\Windows\\System32\\`+tt.image+`"}`, "json")
+		require.NoError(t, err)
+		if tt.id == "" {
+			assert.False(t, matched, tt.image)
+			continue
+		}
+		require.True(t, matched, tt.image)
+		require.Len(t, msg.Result.MatchList, 1, tt.image)
+		rule := msg.Result.MatchList[0]
+		assert.Equal(t, []interface{}{tt.id, tt.title, tt.level}, []interface{}{rule.ID, rule.Title, rule.Level}, tt.image)
+	}
+
+	report := engine.LoadReport()
+	assert.Equal(t, []int{1, 4, 4}, []int{report.Files, report.Total, report.Ok})
+	assert.Equal(t, 3, report.Rules[2].Part)
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"global only", "action: global\ntitle: Global\n", "no rule"},
+		{"unknown action", "title: First\n---\naction: merge\n", "unknown action"},
+		{"repeat without rule", "action: global\ntitle: Global\n---\naction: repeat\ntitle: Repeated\n", "without a previous rule"},
+		{"invalid document", "title: First\n---\ntitle: [broken\n", "did not find expected"},
+	}
+	for _, tt := range tests {
+		_, err := tools.ParseRules([]byte(tt.data))
+		if assert.Error(t, err, tt.name) {
+			assert.Contains(t, err.Error(), tt.err, tt.name)
+		}
+	}
+}
+
+func TestRuleIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-identity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	whoami, err := ioutil.ReadFile("testdata/rules/proc_creation_win_whoami.yml")
+	require.NoError(t, err)
+	powershell, err := ioutil.ReadFile("testdata/rules/proc_creation_win_powershell_encoded.yml")
+	require.NoError(t, err)
+	const replacementID = "8f3a9d2c-1b4e-4c7a-9e5d-2f6b8a0c4d1e"
+	noID := []byte(`title: Hostname Discovery
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        Image: 'C:\Windows\System32\hostname.exe'
+    condition: selection
+`)
+	files := map[string][]byte{
+		"a_whoami.yml":    whoami,
+		"b_duplicate.yml": whoami,
+		"c_no_id.yml":     noID,
+		"d_replacement.yml": []byte(`title: Encoded PowerShell
+id: ` + replacementID + `
+related:
+    - id: ` + powershellID + `
+      type: obsoletes
+    - id: ` + whoamiID + `
+      type: derived
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        CommandLine: '*powershell* -e *'
+    condition: selection
+`),
+		"e_powershell.yml": powershell,
+	}
+	for name, data := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	engine, err := singe.NewEngine(dir)
+	require.NoError(t, err)
+	generatedID := tools.ContentID(noID)
+	assert.Equal(t, []string{whoamiID, generatedID, replacementID}, ruleIDs(engine))
+	// Generated IDs are stable across loads
+	reloaded, err := singe.NewEngine(dir)
+	require.NoError(t, err)
+	assert.Equal(t, ruleIDs(engine), ruleIDs(reloaded))
+
+	report := engine.LoadReport()
+	require.Len(t, report.Rules, 5)
+	var duplicate tools.DuplicateIDError
+	require.True(t, errors.As(report.Rules[1].Err, &duplicate))
+	assert.Equal(t, tools.DuplicateIDError{ID: whoamiID, Path: filepath.Join(dir, "a_whoami.yml")}, duplicate)
+	assert.True(t, report.Rules[2].GeneratedID)
+	assert.False(t, report.Rules[3].GeneratedID)
+	// Derived rules are kept, obsoleted rules are filtered in favor of their replacement
+	assert.Equal(t, []interface{}{tools.FilteredStatus, "related", replacementID},
+		[]interface{}{report.Rules[4].Status, report.Rules[4].Reason, report.Rules[4].ReplacedBy})
+	assert.Equal(t, []int{5, 3, 1, 1}, []int{report.Total, report.Ok, report.Failed, report.Filtered})
+
+	_, err = singe.NewEngine(dir, singe.FailOnError())
+	assert.Error(t, err)
+}
+
+func TestFailOnError(t *testing.T) {
+	_, err := singe.NewEngine("testdata/broken", singe.FailOnError())
+	assert.Error(t, err)
+	// Unsupported rules do not fail engine creation
+	_, err = singe.NewEngine("testdata/broken", singe.FailOnError(), singe.ExcludePaths("invalid_yaml.yml", "missing_selection.yml"))
+	assert.NoError(t, err)
+	// CreateEngine logs the error and keeps the rules that loaded
+	engine := singe.CreateEngine("testdata/broken", singe.FailOnError())
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine))
+}
+
+func TestNewEngine(t *testing.T) {
+	engine, err := singe.NewEngine("testdata/rules")
+	require.NoError(t, err)
+	assert.Len(t, engine.Rules(), 2)
+
+	_, err = singe.NewEngine("testdata/missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	engine, err = singe.NewEngine("testdata/broken", singe.FailOnError())
+	var loadErr tools.LoadError
+	require.True(t, errors.As(err, &loadErr))
+	assert.Len(t, loadErr.Rules, 2)
+	// The engine of the rules that loaded is still returned along with the error
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine))
+
+	// CreateEngine logs directory errors and returns an engine without rules, with or without FailOnError
+	engine = singe.CreateEngine("testdata/missing", singe.FailOnError())
+	assert.Empty(t, engine.Rules())
+	engine = singe.CreateEngine("testdata/missing")
+	assert.Empty(t, engine.Rules())
+	_, matched, err := engine.Evaluate(whoamiEvent, "json")
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestNewEnginePermissions(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	dir := copyRules(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Chmod(filepath.Join(dir, "windows"), 0))
+	defer os.Chmod(filepath.Join(dir, "windows"), 0755)
+
+	_, err := singe.NewEngine(dir)
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
@@ -0,0 +1,84 @@
+package unit_tests
+
+import (
+	"strings"
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestNavigatorLayer(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+
+	layer := engine.NavigatorLayer(singe.NavigatorOptions{Name: "coverage"})
+	assert.Equal(t, "coverage", layer.Name)
+	assert.Equal(t, "enterprise-attack", layer.Domain)
+	require.Len(t, layer.Techniques, 2)
+	assert.Equal(t, "T1033", layer.Techniques[0].TechniqueID)
+	// A single high rule
+	assert.Equal(t, 4.0, layer.Techniques[0].Score)
+	assert.Equal(t, "T1059.001", layer.Techniques[1].TechniqueID)
+	// A single medium rule
+	assert.Equal(t, 3.0, layer.Techniques[1].Score)
+	assert.Equal(t, 4.0, layer.Gradient.MaxValue)
+}
+
+func TestNavigatorLayerLevels(t *testing.T) {
+	const rule = `title: Level Test
+id: 0d1c2b3a-4f5e-4d6c-8b7a-112233445566
+logsource:
+    product: windows
+detection:
+    selection:
+        Image: whoami.exe
+    condition: selection
+tags:
+    - attack.t1033
+`
+	tests := []struct {
+		level string
+		score float64
+	}{
+		{"", 0.5},
+		{"informational", 1},
+		{"low", 2},
+		{"critical", 5},
+	}
+	for _, tt := range tests {
+		data := rule
+		if tt.level != "" {
+			data += "level: " + tt.level + "\n"
+		}
+		engine, err := singe.NewEngineFrom(singe.FromBytes("level.yml", []byte(data)), singe.FailOnError())
+		require.NoError(t, err)
+		layer := engine.NavigatorLayer(singe.NavigatorOptions{})
+		require.Len(t, layer.Techniques, 1, tt.level)
+		assert.Equal(t, tt.score, layer.Techniques[0].Score, tt.level)
+	}
+}
+
+func TestNavigatorLayerMatchCounts(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+
+	previous := `{"event": {}, "sigma": {"ids": ["ca2092a1-c273-4878-9b4b-0d60115bf5ea"], "count": 1}}
+{"event": {}, "sigma": {"ids": ["ca2092a1-c273-4878-9b4b-0d60115bf5ea", "e28a5a99-da44-436d-b7a0-2afc20a5f413"], "count": 2}}
+`
+	counts, err := singe.CountMatches(strings.NewReader(previous))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"ca2092a1-c273-4878-9b4b-0d60115bf5ea": 2,
+		"e28a5a99-da44-436d-b7a0-2afc20a5f413": 1,
+	}, counts)
+
+	layer := engine.NavigatorLayer(singe.NavigatorOptions{MatchCounts: counts})
+	require.Len(t, layer.Techniques, 2)
+	assert.Equal(t, 1.0, layer.Techniques[0].Score)
+	assert.Equal(t, 2.0, layer.Techniques[1].Score)
+	assert.Equal(t, 2.0, layer.Gradient.MaxValue)
+
+	// ECS and OCSF output carry no sigma result to count
+	_, err = singe.CountMatches(strings.NewReader(`{"event": {"kind": "alert"}, "rule": {"id": "ca2092a1-c273-4878-9b4b-0d60115bf5ea"}}`))
+	assert.EqualError(t, err, "line 1: not a match of the json output format")
+}
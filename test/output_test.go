@@ -0,0 +1,242 @@
+package unit_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	attack "github.com/Adversary-Informed-Defense/singe/pkg/singe/attack"
+	objx "github.com/stretchr/objx"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+const whoamiEvent = `{"Image": "C:\\Windows\\System32\\whoami.exe", "host": {"name": "DC1.insecurebank.local"}, "event": {"code": "1"}}`
+
+func TestParseFormat(t *testing.T) {
+	format, err := singe.ParseFormat("ECS")
+	assert.NoError(t, err)
+	assert.Equal(t, singe.ECSFormat, format)
+
+	_, err = singe.ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestECSOutput(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules").WithFormat(singe.ECSFormat)
+
+	output, matched, err := engine.Match(whoamiEvent, "json")
+	require.NoError(t, err)
+	require.True(t, matched)
+
+	doc, err := objx.FromJSON(string(output))
+	require.NoError(t, err)
+	assert.Equal(t, "alert", doc.Get("event.kind").String())
+	assert.EqualValues(t, 73, doc.Get("event.severity").Data())
+	assert.Equal(t, "1", doc.Get("event.code").String())
+	assert.Equal(t, whoamiEvent, doc.Get("event.original").String())
+	assert.Equal(t, "DC1.insecurebank.local", doc.Get("host.name").String())
+	assert.Equal(t, "e28a5a99-da44-436d-b7a0-2afc20a5f413", doc.Get("rule.id").String())
+	assert.Equal(t, "Whoami Execution", doc.Get("rule.name").String())
+	assert.Equal(t, "sigma", doc.Get("rule.ruleset").String())
+	assert.Equal(t, "MITRE ATT&CK", doc.Get("threat.framework").String())
+	assert.Equal(t, []interface{}{"TA0007"}, doc.Get("threat.tactic.id").Data())
+	assert.Equal(t, []interface{}{"T1033"}, doc.Get("threat.technique.id").Data())
+	assert.True(t, doc.Has("@timestamp"))
+}
+
+func TestECSOutputPerRule(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+
+	result, matched, err := engine.Evaluate(`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "powershell.exe -enc SQBFAFgA"}`, "json")
+	require.NoError(t, err)
+	require.True(t, matched)
+	require.Equal(t, 2, result.Result.Count)
+
+	output, err := singe.ECSFormat.Encode(result)
+	require.NoError(t, err)
+
+	var docs []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for decoder.More() {
+		var doc map[string]interface{}
+		require.NoError(t, decoder.Decode(&doc))
+		docs = append(docs, doc)
+	}
+	require.Len(t, docs, 2)
+	// Rules are evaluated in file order
+	assert.Equal(t, "ca2092a1-c273-4878-9b4b-0d60115bf5ea", objx.New(docs[0]).Get("rule.id").String())
+	technique := objx.New(docs[0]).Get("threat.technique")
+	assert.Equal(t, []interface{}{"T1059"}, technique.ObjxMap().Get("id").Data())
+	assert.Equal(t, []interface{}{"T1059.001"}, technique.ObjxMap().Get("subtechnique.id").Data())
+}
+
+func TestOCSFOutput(t *testing.T) {
+	matrix, err := attack.LoadBundle("testdata/attack/enterprise-attack.json")
+	require.NoError(t, err)
+	engine := singe.CreateEngine("testdata/rules").WithAttack(matrix).WithFormat(singe.OCSFFormat)
+
+	output, matched, err := engine.Match(`{"CommandLine": "powershell.exe -enc SQBFAFgA"}`, "json")
+	require.NoError(t, err)
+	require.True(t, matched)
+
+	doc, err := objx.FromJSON(string(output))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2004, doc.Get("class_uid").Data())
+	assert.EqualValues(t, 2, doc.Get("category_uid").Data())
+	assert.EqualValues(t, 200401, doc.Get("type_uid").Data())
+	assert.EqualValues(t, 3, doc.Get("severity_id").Data())
+	assert.Equal(t, "Medium", doc.Get("severity").String())
+	assert.Equal(t, "ca2092a1-c273-4878-9b4b-0d60115bf5ea", doc.Get("finding_info.analytic.uid").String())
+	assert.Equal(t, "Encoded PowerShell Command Line", doc.Get("finding_info.title").String())
+	assert.Equal(t, `{"CommandLine": "powershell.exe -enc SQBFAFgA"}`, doc.Get("raw_data").String())
+	assert.Equal(t, "powershell.exe -enc SQBFAFgA", doc.Get("unmapped.CommandLine").String())
+
+	attacks := doc.Get("finding_info.attacks").ObjxMapSlice()
+	require.Len(t, attacks, 1)
+	assert.Equal(t, "TA0002", attacks[0].Get("tactic.uid").String())
+	assert.Equal(t, "T1059", attacks[0].Get("technique.uid").String())
+	assert.Equal(t, "T1059.001", attacks[0].Get("sub_technique.uid").String())
+	assert.Equal(t, "PowerShell", attacks[0].Get("sub_technique.name").String())
+}
+
+func TestSARIFOutput(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+	sarif := singe.NewSARIFWriter(engine)
+
+	f, err := os.Open("testdata/logs/process_creation.jsonl")
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, engine.Scan(f, "json", func(line int, msg singe.OutputMessage) error {
+		sarif.Add("testdata/logs/process_creation.jsonl", line, msg)
+		return nil
+	}))
+
+	var buf bytes.Buffer
+	require.NoError(t, sarif.Write(&buf))
+	doc, err := objx.FromJSON(buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, "2.1.0", doc.Get("version").String())
+
+	run := doc.Get("runs").ObjxMapSlice()[0]
+	rules := run.Get("tool.driver.rules").ObjxMapSlice()
+	require.Len(t, rules, 2)
+	assert.Equal(t, "ca2092a1-c273-4878-9b4b-0d60115bf5ea", rules[0].Get("id").String())
+	assert.Equal(t, "warning", rules[0].Get("defaultConfiguration.level").String())
+	assert.Equal(t, "error", rules[1].Get("defaultConfiguration.level").String())
+
+	results := run.Get("results").ObjxMapSlice()
+	require.Len(t, results, 2)
+	assert.Equal(t, "e28a5a99-da44-436d-b7a0-2afc20a5f413", results[0].Get("ruleId").String())
+	assert.EqualValues(t, 1, results[0].Get("ruleIndex").Data())
+	assert.Equal(t, "error", results[0].Get("level").String())
+	location := results[0].Get("locations").ObjxMapSlice()[0]
+	assert.Equal(t, "testdata/logs/process_creation.jsonl", location.Get("physicalLocation.artifactLocation.uri").String())
+	assert.EqualValues(t, 1, location.Get("physicalLocation.region.startLine").Data())
+	// The unparseable third line is skipped without shifting line numbers
+	location = results[1].Get("locations").ObjxMapSlice()[0]
+	assert.EqualValues(t, 4, location.Get("physicalLocation.region.startLine").Data())
+}
+
+func TestSTIXOutput(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+	stix, err := singe.NewSTIXWriter(engine)
+	require.NoError(t, err)
+
+	first := time.Date(2021, 3, 25, 21, 28, 45, 0, time.UTC)
+	for i, event := range []string{whoamiEvent, whoamiEvent, `{"CommandLine": "powershell.exe -enc SQBFAFgA"}`} {
+		msg, matched, err := engine.Evaluate(event, "json")
+		require.NoError(t, err)
+		require.True(t, matched)
+		require.NoError(t, stix.Add(msg, first.Add(time.Duration(i)*time.Minute)))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, stix.Write(&buf))
+	doc, err := objx.FromJSON(buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", doc.Get("type").String())
+
+	byType := make(map[string][]objx.Map)
+	for _, obj := range doc.Get("objects").ObjxMapSlice() {
+		byType[obj.Get("type").String()] = append(byType[obj.Get("type").String()], obj)
+	}
+	require.Len(t, byType["indicator"], 2)
+	require.Len(t, byType["attack-pattern"], 2)
+	require.Len(t, byType["relationship"], 2)
+	require.Len(t, byType["sighting"], 2)
+
+	indicators := make(map[string]objx.Map)
+	for _, indicator := range byType["indicator"] {
+		assert.Equal(t, "sigma", indicator.Get("pattern_type").String())
+		assert.Contains(t, indicator.Get("pattern").String(), "detection:")
+		// The pattern is the rule file, with the attributes that the Sigma rule type drops
+		assert.Contains(t, indicator.Get("pattern").String(), "falsepositives:")
+		indicators[indicator.Get("id").String()] = indicator
+	}
+
+	// Sightings are ordered by rule ID
+	whoami := byType["sighting"][1]
+	assert.Equal(t, "Whoami Execution", indicators[whoami.Get("sighting_of_ref").String()].Get("name").String())
+	assert.EqualValues(t, 2, whoami.Get("count").Data())
+	assert.Equal(t, "2021-03-25T21:28:45.000Z", whoami.Get("first_seen").String())
+	assert.Equal(t, "2021-03-25T21:29:45.000Z", whoami.Get("last_seen").String())
+}
+
+func TestSTIXCollectionIndicators(t *testing.T) {
+	const collection = `action: global
+title: Token Manipulation
+status: test
+tags:
+    - attack.privilege-escalation
+    - attack.t1134
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    condition: selection
+level: high
+---
+id: 5b1f0c7e-2d3a-4e8b-9c6f-7a0d1e2f3b4c
+detection:
+    selection:
+        Image|endswith: '\incognito.exe'
+---
+id: 8e2a4b6c-1d3f-4a5b-8c7d-9e0f1a2b3c4d
+detection:
+    selection:
+        Image|endswith: '\tokenvator.exe'
+`
+	engine, err := singe.NewEngineFrom(singe.FromBytes("token.yml", []byte(collection)), singe.FailOnError())
+	require.NoError(t, err)
+	stix, err := singe.NewSTIXWriter(engine)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, stix.Write(&buf))
+	doc, err := objx.FromJSON(buf.String())
+	require.NoError(t, err)
+
+	var patterns []string
+	for _, obj := range doc.Get("objects").ObjxMapSlice() {
+		if obj.Get("type").String() != "indicator" {
+			continue
+		}
+		// The ATT&CK kill chain writes tactics hyphenated
+		phases := obj.Get("kill_chain_phases").ObjxMapSlice()
+		require.Len(t, phases, 1)
+		assert.Equal(t, "privilege-escalation", phases[0].Get("phase_name").String())
+		patterns = append(patterns, obj.Get("pattern").String())
+	}
+	// Each rule of the collection carries its own document, merged with the global one
+	require.Len(t, patterns, 2)
+	for i, own := range []string{"incognito.exe", "tokenvator.exe"} {
+		other := []string{"tokenvator.exe", "incognito.exe"}[i]
+		assert.Contains(t, patterns[i], own)
+		assert.Contains(t, patterns[i], "title: Token Manipulation")
+		assert.NotContains(t, patterns[i], other)
+		assert.NotContains(t, patterns[i], "action:")
+	}
+}
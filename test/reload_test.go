@@ -0,0 +1,231 @@
+package unit_tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+const whoamiLine = `{"Image": "C:\\Windows\\System32\\whoami.exe"}`
+
+// writeTestRule copies a test rule into a directory, replacing its content with the data argument if set
+// The file is renamed into place so that a polling engine never reads it partially written
+func writeTestRule(t *testing.T, dir string, name string, data []byte) {
+	if data == nil {
+		var err error
+		data, err = ioutil.ReadFile(filepath.Join("testdata/rules", name))
+		require.NoError(t, err)
+	}
+	tmp := filepath.Join(dir, name+".tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, data, 0644))
+	require.NoError(t, os.Rename(tmp, filepath.Join(dir, name)))
+}
+
+func TestReloadableEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", nil)
+
+	engine, err := singe.NewReloadableEngine(singe.FromDir(dir), nil)
+	require.NoError(t, err)
+	_, matched, err := engine.Match(whoamiLine, "json")
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	whoami, err := ioutil.ReadFile(filepath.Join("testdata/rules", "proc_creation_win_whoami.yml"))
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		change func()
+		diff   singe.RuleDiff
+		err    bool
+		ids    []string
+	}{
+		{"unchanged", func() {}, singe.RuleDiff{}, false, []string{whoamiID}},
+		{"added", func() {
+			writeTestRule(t, dir, "proc_creation_win_powershell_encoded.yml", nil)
+		}, singe.RuleDiff{Added: []string{powershellID}}, false, []string{whoamiID, powershellID}},
+		{"changed", func() {
+			writeTestRule(t, dir, "proc_creation_win_whoami.yml", append(whoami, []byte("\nauthor: Someone Else\n")...))
+		}, singe.RuleDiff{Changed: []string{whoamiID}}, false, []string{whoamiID, powershellID}},
+		{"broken rule keeps the previous rules", func() {
+			writeTestRule(t, dir, "broken.yml", []byte("title: [broken"))
+		}, singe.RuleDiff{}, true, []string{whoamiID, powershellID}},
+		{"removed", func() {
+			require.NoError(t, os.Remove(filepath.Join(dir, "broken.yml")))
+			require.NoError(t, os.Remove(filepath.Join(dir, "proc_creation_win_powershell_encoded.yml")))
+		}, singe.RuleDiff{Removed: []string{powershellID}}, false, []string{whoamiID}},
+	}
+	for _, test := range tests {
+		test.change()
+		diff, err := engine.Reload()
+		if test.err {
+			assert.Error(t, err, test.name)
+		} else {
+			assert.NoError(t, err, test.name)
+		}
+		assert.Equal(t, test.diff, diff, test.name)
+		assert.ElementsMatch(t, test.ids, ruleIDs(engine.Engine()), test.name)
+	}
+}
+
+func TestReloadableEngineFailedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", nil)
+	writeTestRule(t, dir, "broken.yml", []byte("title: [broken"))
+
+	// The first load skips failed rules unless FailOnError is set
+	_, err = singe.NewReloadableEngine(singe.FromDir(dir), nil, singe.FailOnError())
+	assert.Error(t, err)
+	engine, err := singe.NewReloadableEngine(singe.FromDir(dir), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine.Engine()))
+
+	// Rules that already failed do not block reloads, rules that fail anew do
+	writeTestRule(t, dir, "proc_creation_win_powershell_encoded.yml", nil)
+	diff, err := engine.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{powershellID}, diff.Added)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", []byte("title: [broken"))
+	_, err = engine.Reload()
+	assert.Error(t, err)
+	assert.ElementsMatch(t, []string{whoamiID, powershellID}, ruleIDs(engine.Engine()))
+
+	// Neither do rules that loaded before and are now unsupported
+	whoami, err := ioutil.ReadFile(filepath.Join("testdata/rules", "proc_creation_win_whoami.yml"))
+	require.NoError(t, err)
+	unsupported := strings.Replace(string(whoami), "condition: selection", "condition: selection | count() > 5", 1)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", []byte(unsupported))
+	_, err = engine.Reload()
+	assert.Error(t, err)
+	assert.ElementsMatch(t, []string{whoamiID, powershellID}, ruleIDs(engine.Engine()))
+}
+
+func TestReloadableEngineWatchUnchangedFiles(t *testing.T) {
+	whoami, err := ioutil.ReadFile(filepath.Join("testdata/rules", "proc_creation_win_whoami.yml"))
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join("testdata/rules", "proc_creation_win_whoami.yml"))
+	require.NoError(t, err)
+	var reads int32
+	source := func() ([]tools.RuleFile, error) {
+		return []tools.RuleFile{{
+			Path: "proc_creation_win_whoami.yml",
+			Rel:  "proc_creation_win_whoami.yml",
+			Read: func() ([]byte, error) {
+				atomic.AddInt32(&reads, 1)
+				return whoami, nil
+			},
+			Stat: func() (os.FileInfo, error) {
+				return info, nil
+			},
+		}}, nil
+	}
+
+	engine, err := singe.NewReloadableEngine(source, nil)
+	require.NoError(t, err)
+	engine.Watch(time.Millisecond, nil)
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, engine.Close())
+	// Files whose size and modification time did not change are not read again
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reads))
+}
+
+func TestReloadableEngineConfigure(t *testing.T) {
+	configured := 0
+	engine, err := singe.NewReloadableEngine(singe.FromDir("testdata/rules"), func(engine singe.SigmaEngine) singe.SigmaEngine {
+		configured++
+		return engine.WithFormat(singe.ECSFormat)
+	}, singe.IncludeIDs(whoamiID))
+	require.NoError(t, err)
+	_, err = engine.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 2, configured)
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine.Engine()))
+	out, matched, err := engine.Match(whoamiLine, "json")
+	require.NoError(t, err)
+	assert.True(t, matched)
+	assert.Contains(t, string(out), `"kind":"alert"`)
+}
+
+func TestReloadableEngineWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", nil)
+
+	engine, err := singe.NewReloadableEngine(singe.FromDir(dir), nil)
+	require.NoError(t, err)
+	type reload struct {
+		diff singe.RuleDiff
+		err  error
+	}
+	reloads := make(chan reload, 10)
+	engine.Watch(5*time.Millisecond, func(diff singe.RuleDiff, err error) {
+		reloads <- reload{diff, err}
+	})
+	next := func() reload {
+		select {
+		case r := <-reloads:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload")
+			return reload{}
+		}
+	}
+
+	// Matches never fail or miss the rule kept across reloads
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, matched, err := engine.Match(whoamiLine, "json")
+				assert.NoError(t, err)
+				assert.True(t, matched)
+			}
+		}()
+	}
+
+	writeTestRule(t, dir, "proc_creation_win_powershell_encoded.yml", nil)
+	r := next()
+	assert.NoError(t, r.err)
+	assert.Equal(t, []string{powershellID}, r.diff.Added)
+
+	writeTestRule(t, dir, "broken.yml", []byte("title: [broken"))
+	r = next()
+	assert.Error(t, r.err)
+	assert.ElementsMatch(t, []string{whoamiID, powershellID}, ruleIDs(engine.Engine()))
+	// A rejected snapshot is not reported again until it changes
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, reloads)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken.yml")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "proc_creation_win_powershell_encoded.yml")))
+	r = next()
+	assert.NoError(t, r.err)
+	assert.Equal(t, []string{powershellID}, r.diff.Removed)
+
+	close(stop)
+	wg.Wait()
+	require.NoError(t, engine.Close())
+}
@@ -0,0 +1,51 @@
+package unit_tests
+
+import (
+	"strings"
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	const hostnameID = "7d2f4e1a-9b3c-4a5d-8e6f-0a1b2c3d4e5f"
+	baseline, err := singe.NewEngine("testdata/rules")
+	require.NoError(t, err)
+	candidate, err := singe.NewEngine("testdata/ruletest", singe.ExcludeIDs(whoamiID))
+	require.NoError(t, err)
+
+	corpus := strings.Join([]string{
+		`{"Image": "C:\\Windows\\System32\\whoami.exe"}`,
+		`{"Image": "C:\\Windows\\System32\\notepad.exe"}`,
+		"",
+		`{"Image": "C:\\Windows\\System32\\hostname.exe"}`,
+		"not json",
+		`{"CommandLine": "powershell.exe -enc SQBFAFgA"}`,
+		`{"Image": "C:\\Windows\\System32\\whoami.exe", "User": "SYSTEM"}`,
+	}, "\n")
+	replayer := singe.NewReplayer(baseline, candidate, 1)
+	require.NoError(t, replayer.Replay("corpus.jsonl", strings.NewReader(corpus), "json"))
+	report := replayer.Report()
+
+	assert.Equal(t, 6, report.Events)
+	assert.Equal(t, 1, report.Errors)
+	require.Len(t, report.Rules, 3)
+	hostname, powershell, whoami := report.Rules[0], report.Rules[1], report.Rules[2]
+
+	assert.Equal(t, singe.RuleReplay{ID: hostnameID, Title: "Hostname Execution", New: 1,
+		NewEvents: []singe.ReplayExample{{Source: "corpus.jsonl", Line: 4, Event: `{"Image": "C:\\Windows\\System32\\hostname.exe"}`}}}, hostname)
+	assert.Equal(t, singe.RuleReplay{ID: powershellID, Title: "Encoded PowerShell Command Line", Unchanged: 1}, powershell)
+	assert.Equal(t, whoamiID, whoami.ID)
+	assert.Equal(t, 2, whoami.Lost)
+	// Examples are bounded
+	require.Len(t, whoami.LostEvents, 1)
+	assert.Equal(t, 1, whoami.LostEvents[0].Line)
+
+	changed := report.Changed()
+	require.Len(t, changed, 2)
+	assert.Equal(t, hostnameID, changed[0].ID)
+	assert.Equal(t, whoamiID, changed[1].ID)
+	assert.Equal(t, whoamiID+" Whoami Execution: 0 new, 2 lost, 0 unchanged", changed[1].String())
+}
@@ -0,0 +1,138 @@
+package unit_tests
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	ruletest "github.com/Adversary-Informed-Defense/singe/pkg/singe/ruletest"
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+const ruletestDir = "testdata/ruletest"
+
+func TestLoadSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		samples []ruletest.Sample
+		err     string
+	}{
+		{"none", "title: Test\n", nil, ""},
+		{"defaults", "title: Test\ntests:\n    - event: whoami\n", []ruletest.Sample{{Event: "whoami"}}, ""},
+		{"fields", "tests:\n    - name: no whoami\n      rule: e28a5a99-da44-436d-b7a0-2afc20a5f413\n      vendor: json\n      expect: no_match\n      event: '{}'\n",
+			[]ruletest.Sample{{Name: "no whoami", Rule: "e28a5a99-da44-436d-b7a0-2afc20a5f413", Vendor: "json", Expect: ruletest.MustNotMatch, Event: "{}"}}, ""},
+		{"expectation", "tests:\n    - expect: matches\n", nil, `unknown expectation "matches"`},
+	}
+	for _, tt := range tests {
+		samples, err := ruletest.LoadSamples("rule.yml", []byte(tt.rule))
+		if tt.err != "" {
+			assert.Error(t, err, tt.name)
+			assert.Contains(t, err.Error(), tt.err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.samples, samples, tt.name)
+	}
+
+	// Sidecar samples follow the samples of the rule file
+	path := filepath.Join(ruletestDir, "proc_creation_win_powershell_encoded.yml")
+	samples, err := ruletest.LoadSamples(path, []byte("tests:\n    - name: inline\n"))
+	require.NoError(t, err)
+	require.Len(t, samples, 4)
+	assert.Equal(t, "inline", samples[0].Name)
+	assert.Equal(t, "encoded command", samples[1].Name)
+}
+
+func TestRun(t *testing.T) {
+	report, err := ruletest.Run(ruletestDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(ruletestDir, "proc_creation_win_hostname.yml")}, report.Untested)
+	require.Len(t, report.Rules, 2)
+	assert.Equal(t, 1, report.Failures())
+
+	powershell, whoami := report.Rules[0], report.Rules[1]
+	assert.Equal(t, "Encoded PowerShell Command Line", powershell.Title)
+	assert.False(t, powershell.Passed())
+	require.Len(t, powershell.Samples, 3)
+	assert.True(t, powershell.Samples[0].Passed)
+	assert.Equal(t, []string{"ca2092a1-c273-4878-9b4b-0d60115bf5ea"}, powershell.Samples[0].Matched)
+	assert.True(t, powershell.Samples[1].Passed)
+	assert.False(t, powershell.Samples[2].Passed)
+	assert.Equal(t, "expected a match, the event matched no tested rule", powershell.Samples[2].Failure)
+
+	assert.True(t, whoami.Passed())
+	assert.Equal(t, []string{"e28a5a99-da44-436d-b7a0-2afc20a5f413"}, whoami.IDs)
+	require.Len(t, whoami.Samples, 2)
+	assert.Equal(t, ruletest.MustNotMatch, whoami.Samples[1].Expect)
+
+	// Samples of filtered rules are skipped rather than failed
+	report, err = ruletest.Run(ruletestDir, singe.IncludeIDs("e28a5a99-da44-436d-b7a0-2afc20a5f413"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Failures())
+	require.Len(t, report.Rules, 2)
+	for _, sample := range report.Rules[0].Samples {
+		assert.True(t, sample.Skipped)
+	}
+}
+
+func TestRunFailOnError(t *testing.T) {
+	missing := filepath.Join("testdata/broken", "missing_selection.yml")
+	report, err := ruletest.Run("testdata/broken")
+	require.NoError(t, err)
+	assert.Contains(t, report.Untested, missing)
+
+	// Rule files that failed to load fail even without samples
+	report, err = ruletest.Run("testdata/broken", singe.FailOnError())
+	require.NoError(t, err)
+	assert.NotContains(t, report.Untested, missing)
+	var paths []string
+	for _, rule := range report.Rules {
+		assert.False(t, rule.Passed(), rule.Path)
+		paths = append(paths, rule.Path)
+	}
+	assert.Equal(t, []string{filepath.Join("testdata/broken", "invalid_yaml.yml"), missing}, paths)
+	assert.Equal(t, 2, report.Failures())
+
+	_, err = ruletest.Run("testdata/missing", singe.FailOnError())
+	assert.Error(t, err)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	report, err := ruletest.Run(ruletestDir)
+	require.NoError(t, err)
+	report.Rules = append(report.Rules, ruletest.RuleResult{Path: "broken.yml", Err: tools.DuplicateIDError{ID: "1", Path: "a.yml"}})
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&buf))
+	var junit struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Errors   int `xml:"errors,attr"`
+		Suites   []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name      string `xml:"name,attr"`
+				Classname string `xml:"classname,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &junit))
+	assert.Equal(t, 6, junit.Tests)
+	assert.Equal(t, 1, junit.Failures)
+	assert.Equal(t, 1, junit.Errors)
+	require.Len(t, junit.Suites, 3)
+	assert.Equal(t, filepath.Join(ruletestDir, "proc_creation_win_powershell_encoded.yml"), junit.Suites[0].Name)
+	failed := junit.Suites[0].Cases[2]
+	assert.Equal(t, "encoded command without a space", failed.Name)
+	assert.Equal(t, "Encoded PowerShell Command Line", failed.Classname)
+	require.NotNil(t, failed.Failure)
+	assert.Nil(t, junit.Suites[1].Cases[0].Failure)
+}
@@ -0,0 +1,434 @@
+package unit_tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	sinks "github.com/Adversary-Informed-Defense/singe/pkg/singe/sinks"
+	types "github.com/Adversary-Informed-Defense/singe/pkg/singe/types"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+// captureSink records the output messages written to it
+type captureSink struct {
+	mu   sync.Mutex
+	msgs []singe.OutputMessage
+}
+
+func (c *captureSink) Write(msg singe.OutputMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func (c *captureSink) Close() error {
+	return nil
+}
+
+// evaluateBoth returns an output message matched by both test rules
+func evaluateBoth(t *testing.T) singe.OutputMessage {
+	engine := singe.CreateEngine("testdata/rules")
+	msg, matched, err := engine.Evaluate(`{"Image": "C:\\Windows\\System32\\whoami.exe", "CommandLine": "powershell.exe -enc SQBFAFgA"}`, "json")
+	require.NoError(t, err)
+	require.True(t, matched)
+	require.Equal(t, 2, msg.Result.Count)
+	return msg
+}
+
+func TestRouter(t *testing.T) {
+	all := &captureSink{}
+	high := &captureSink{}
+	execution := &captureSink{}
+	critical := &captureSink{}
+	router := sinks.NewRouter(
+		sinks.Route{Sink: all},
+		sinks.Route{Sink: high, MinLevel: types.HighLevel},
+		sinks.Route{Sink: execution, Tags: []string{"attack.t1059*"}},
+		sinks.Route{Sink: critical, MinLevel: types.CriticalLevel},
+	)
+	require.NoError(t, router.Write(evaluateBoth(t)))
+
+	require.Len(t, all.msgs, 1)
+	assert.Equal(t, 2, all.msgs[0].Result.Count)
+	require.Len(t, high.msgs, 1)
+	assert.Equal(t, []string{"e28a5a99-da44-436d-b7a0-2afc20a5f413"}, high.msgs[0].Result.IDList)
+	assert.Equal(t, []string{"attack.discovery", "attack.t1033", "car.2016-03-001"}, high.msgs[0].Result.TagList)
+	require.Len(t, execution.msgs, 1)
+	assert.Equal(t, []string{"ca2092a1-c273-4878-9b4b-0d60115bf5ea"}, execution.msgs[0].Result.IDList)
+	assert.Len(t, critical.msgs, 0)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.jsonl")
+
+	msg := evaluateBoth(t)
+	line, err := singe.JSONFormat.Encode(msg)
+	require.NoError(t, err)
+
+	sink, err := sinks.NewFileSink(sinks.FileConfig{Path: path, MaxBytes: int64(2*len(line) + 3), MaxBackups: 2})
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, sink.Write(msg))
+	}
+	require.NoError(t, sink.Close())
+
+	// Two lines per file, the oldest file beyond two backups is discarded
+	for _, name := range []string{"alerts.jsonl", "alerts.jsonl.1", "alerts.jsonl.2"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		assert.Equal(t, string(line), lines[0])
+		if name == "alerts.jsonl" {
+			assert.Len(t, lines, 1)
+		} else {
+			assert.Len(t, lines, 2)
+		}
+	}
+	_, err = os.Stat(filepath.Join(dir, "alerts.jsonl.3"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := sinks.NewWebhookSink(sinks.WebhookConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Backoff: sinks.Backoff{MaxRetries: 3, Initial: time.Millisecond},
+	})
+	defer sink.Close()
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+	assert.Equal(t, 3, attempts)
+	assert.Contains(t, bodies[2], `"ids":["ca2092a1-c273-4878-9b4b-0d60115bf5ea","e28a5a99-da44-436d-b7a0-2afc20a5f413"]`)
+}
+
+func TestWebhookSinkPermanentFailure(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := sinks.NewWebhookSink(sinks.WebhookConfig{URL: server.URL, Backoff: sinks.Backoff{Initial: time.Millisecond}})
+	err := sink.Write(evaluateBoth(t))
+	require.Error(t, err)
+	status, ok := err.(sinks.ErrStatus)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, status.Code)
+	// Client errors other than 429 are not retried
+	assert.Equal(t, 1, attempts)
+
+	// Neither are requests that cannot be built
+	start := time.Now()
+	sink = sinks.NewWebhookSink(sinks.WebhookConfig{URL: "http://[::1", Backoff: sinks.Backoff{Initial: time.Second}})
+	require.Error(t, sink.Write(evaluateBoth(t)))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := sinks.NewSyslogSink(sinks.SyslogConfig{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Hostname: "sensor01",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	// local0 (16) and the error severity (3) of the high rule
+	assert.True(t, bytes.HasPrefix(buf[:n], []byte("<131>1 ")))
+	assert.Contains(t, string(buf[:n]), " sensor01 singe ")
+	assert.Contains(t, string(buf[:n]), `"sigma":{"matches"`)
+}
+
+func TestSinkConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := sinks.Config{Sinks: []sinks.SinkConfig{
+		{Type: "file", Path: filepath.Join(dir, "high.jsonl"), MinLevel: "high", Format: "ecs"},
+	}}
+	router, err := config.Build()
+	require.NoError(t, err)
+	require.NoError(t, router.Write(evaluateBoth(t)))
+	require.NoError(t, router.Close())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "high.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"kind":"alert"`)
+
+	_, err = sinks.Config{Sinks: []sinks.SinkConfig{{Type: "kafka"}}}.Build()
+	assert.Error(t, err)
+	_, err = sinks.Config{Sinks: []sinks.SinkConfig{{Type: "stdout", MinLevel: "severe"}}}.Build()
+	assert.Error(t, err)
+}
+
+func TestSplunkHECSinkBatching(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/services/collector/event", r.URL.Path)
+		assert.Equal(t, "Splunk token", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(body))
+		mu.Unlock()
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	sink := sinks.NewSplunkHECSink(sinks.SplunkHECConfig{
+		URL:    server.URL,
+		Token:  "token",
+		Index:  "security",
+		Format: singe.ECSFormat,
+		Batch:  sinks.BatchConfig{MaxEvents: 3, FlushInterval: 50 * time.Millisecond},
+	})
+	defer sink.Close()
+
+	// The ECS format writes one event per matching rule, so the second message fills the batch
+	msg := evaluateBoth(t)
+	require.NoError(t, sink.Write(msg))
+	require.NoError(t, sink.Write(msg))
+	mu.Lock()
+	require.Len(t, requests, 1)
+	assert.Equal(t, 4, strings.Count(requests[0], "\n"))
+	assert.Contains(t, requests[0], `"sourcetype":"_json","index":"security","event":{`)
+	mu.Unlock()
+
+	// Smaller batches are sent on the flush interval
+	require.NoError(t, sink.Write(singe.OutputMessage{}))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requests) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSplunkHECSinkSendDoesNotBlockWrites(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(body))
+		first := len(requests) == 1
+		mu.Unlock()
+		if first {
+			<-release
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	sink := sinks.NewSplunkHECSink(sinks.SplunkHECConfig{
+		URL:    server.URL,
+		Format: singe.ECSFormat,
+		Batch:  sinks.BatchConfig{MaxEvents: 2, FlushInterval: time.Hour},
+	})
+
+	// The first message fills a batch whose request hangs until released
+	msg := evaluateBoth(t)
+	sent := make(chan error)
+	go func() { sent <- sink.Write(msg) }()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requests) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	written := make(chan error)
+	go func() { written <- sink.Write(singe.OutputMessage{}) }()
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("write blocked by a pending send")
+	}
+
+	close(release)
+	require.NoError(t, <-sent)
+	require.NoError(t, sink.Close())
+	require.Len(t, requests, 2)
+	assert.Equal(t, 2, strings.Count(requests[0], "\n"))
+	assert.Equal(t, 1, strings.Count(requests[1], "\n"))
+}
+
+func TestSplunkHECSinkDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dlq := filepath.Join(dir, "hec.dlq")
+	sink := sinks.NewSplunkHECSink(sinks.SplunkHECConfig{
+		URL:     server.URL,
+		Batch:   sinks.BatchConfig{DeadLetterPath: dlq},
+		Backoff: sinks.Backoff{MaxRetries: 2, Initial: time.Millisecond},
+	})
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+	err = sink.Close()
+	require.Error(t, err)
+	assert.Equal(t, 3, attempts)
+
+	data, err := ioutil.ReadFile(dlq)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"event":{"event":{"CommandLine":`)
+}
+
+func TestSplunkHECSinkClosed(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+	}))
+	defer server.Close()
+
+	sink := sinks.NewSplunkHECSink(sinks.SplunkHECConfig{URL: server.URL})
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+	require.NoError(t, sink.Close())
+	assert.ErrorIs(t, sink.Write(evaluateBoth(t)), sinks.ErrClosed)
+	require.NoError(t, sink.Close())
+	assert.Equal(t, 1, requests)
+}
+
+func TestElasticsearchSinkMissingItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	dlq := filepath.Join(dir, "es.dlq")
+	sink, err := sinks.NewElasticsearchSink(sinks.ElasticsearchConfig{
+		URL:    server.URL,
+		Index:  "alerts",
+		Format: singe.ECSFormat,
+		Batch:  sinks.BatchConfig{DeadLetterPath: dlq},
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+	// A response without an item per action fails the whole batch
+	require.Error(t, sink.Close())
+
+	data, err := ioutil.ReadFile(dlq)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+}
+
+func TestElasticsearchSinkPartialFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-sinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "alerts&refresh=true", r.URL.Query().Get("pipeline"))
+		assert.Equal(t, "", r.URL.Query().Get("refresh"))
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "ApiKey key", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			// The first item is rejected by a mapping error and the second one by back pressure
+			w.Write([]byte(`{"errors":true,"items":[` +
+				`{"create":{"status":400,"error":{"type":"mapper_parsing_exception"}}},` +
+				`{"create":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`))
+			return
+		}
+		w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	dlq := filepath.Join(dir, "es.dlq")
+	sink, err := sinks.NewElasticsearchSink(sinks.ElasticsearchConfig{
+		URL:      server.URL,
+		Index:    "logs-singe.alerts-default",
+		APIKey:   "key",
+		Pipeline: "alerts&refresh=true",
+		Format:   singe.ECSFormat,
+		Batch:    sinks.BatchConfig{DeadLetterPath: dlq},
+		Backoff:  sinks.Backoff{Initial: time.Millisecond},
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(evaluateBoth(t)))
+	err = sink.Flush()
+	require.Error(t, err)
+	require.NoError(t, sink.Close())
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, 4, strings.Count(requests[0], "\n"))
+	assert.Contains(t, requests[0], `{"create":{"_index":"logs-singe.alerts-default"}}`)
+	// Only the item rejected with 429 is retried
+	assert.Equal(t, 2, strings.Count(requests[1], "\n"))
+
+	data, err := ioutil.ReadFile(dlq)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	assert.Contains(t, requests[0], string(data))
+
+	_, err = sinks.NewElasticsearchSink(sinks.ElasticsearchConfig{URL: server.URL})
+	assert.Error(t, err)
+}
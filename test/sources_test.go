@@ -0,0 +1,148 @@
+package unit_tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	suppress "github.com/Adversary-Informed-Defense/singe/pkg/singe/suppress"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/rules
+var embeddedRules embed.FS
+
+// rulePack returns the test rules under the rules/ directory of a tar archive, gzip compressed if the compress argument is set
+func rulePack(t *testing.T, compress bool) []byte {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	archive := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		archive = tar.NewWriter(gz)
+	}
+	for _, name := range []string{"proc_creation_win_whoami.yml", "proc_creation_win_powershell_encoded.yml"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/rules", name))
+		require.NoError(t, err)
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: "rules/" + name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err = archive.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.WriteHeader(&tar.Header{Name: "README.md", Mode: 0644, Size: 2, Typeflag: tar.TypeReg}))
+	archive.Write([]byte("# "))
+	require.NoError(t, archive.Close())
+	if gz != nil {
+		require.NoError(t, gz.Close())
+	}
+	return buf.Bytes()
+}
+
+// rulePackZip returns the test rules under the rules/ directory of a zip archive
+func rulePackZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range []string{"proc_creation_win_whoami.yml", "proc_creation_win_powershell_encoded.yml"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/rules", name))
+		require.NoError(t, err)
+		w, err := archive.Create("rules/" + name)
+		require.NoError(t, err)
+		w.Write(data)
+	}
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestRuleSources(t *testing.T) {
+	whoami, err := ioutil.ReadFile("testdata/rules/proc_creation_win_whoami.yml")
+	require.NoError(t, err)
+	tarPack := rulePack(t, false)
+	zipPack := rulePackZip(t)
+
+	tests := []struct {
+		name   string
+		source singe.RuleSource
+		ids    []string
+		paths  []string
+	}{
+		{"dir", singe.FromDir("testdata/rules"), []string{powershellID, whoamiID}, []string{"testdata/rules/proc_creation_win_powershell_encoded.yml", "testdata/rules/proc_creation_win_whoami.yml"}},
+		{"embed", singe.FromFS(embeddedRules, "testdata/rules"), []string{powershellID, whoamiID}, []string{"testdata/rules/proc_creation_win_powershell_encoded.yml", "testdata/rules/proc_creation_win_whoami.yml"}},
+		{"bytes", singe.FromBytes("whoami.yml", whoami), []string{whoamiID}, []string{"whoami.yml"}},
+		{"reader", singe.FromReader("whoami.yml", bytes.NewReader(whoami)), []string{whoamiID}, []string{"whoami.yml"}},
+		{"tar", singe.FromTar(bytes.NewReader(tarPack)), []string{whoamiID, powershellID}, []string{"rules/proc_creation_win_whoami.yml", "rules/proc_creation_win_powershell_encoded.yml"}},
+		{"tar.gz", singe.FromTar(bytes.NewReader(rulePack(t, true))), []string{whoamiID, powershellID}, []string{"rules/proc_creation_win_whoami.yml", "rules/proc_creation_win_powershell_encoded.yml"}},
+		{"zip", singe.FromZip(bytes.NewReader(zipPack), int64(len(zipPack))), []string{powershellID, whoamiID}, []string{"rules/proc_creation_win_powershell_encoded.yml", "rules/proc_creation_win_whoami.yml"}},
+		{"combined", singe.Sources(singe.FromBytes("whoami.yml", whoami), singe.FromFS(embeddedRules, "testdata/rules")), []string{whoamiID, powershellID}, []string{"whoami.yml", "testdata/rules/proc_creation_win_powershell_encoded.yml", "testdata/rules/proc_creation_win_whoami.yml"}},
+	}
+	for _, tt := range tests {
+		engine, err := singe.NewEngineFrom(tt.source)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.ids, ruleIDs(engine), tt.name)
+		var paths []string
+		for _, rule := range engine.LoadReport().Rules {
+			paths = append(paths, rule.Path)
+		}
+		assert.Equal(t, tt.paths, paths, tt.name)
+
+		_, matched, err := engine.Evaluate(whoamiEvent, "json")
+		require.NoError(t, err)
+		assert.True(t, matched, tt.name)
+	}
+
+	// Path filters match paths relative to the source root
+	engine, err := singe.NewEngineFrom(singe.FromFS(embeddedRules, "testdata/rules"), singe.IncludePaths("proc_creation_win_whoami.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{whoamiID}, ruleIDs(engine))
+	engine, err = singe.NewEngineFrom(singe.FromTar(bytes.NewReader(tarPack)), singe.SkipRulePaths("rules"))
+	require.NoError(t, err)
+	assert.Empty(t, ruleIDs(engine))
+
+	_, err = singe.NewEngineFrom(singe.FromFS(embeddedRules, "testdata/missing"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = singe.NewEngineFrom(singe.FromTar(bytes.NewReader([]byte("not a tar archive, but long enough to hold a header"))))
+	assert.Error(t, err)
+}
+
+func TestRuleArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-packs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pack.tgz"), rulePack(t, true), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pack.zip"), rulePackZip(t), 0644))
+
+	for _, name := range []string{"pack.tgz", "pack.zip"} {
+		engine, err := singe.NewEngineFrom(singe.FromArchive(filepath.Join(dir, name)))
+		require.NoError(t, err)
+		assert.Len(t, engine.Rules(), 2, name)
+	}
+}
+
+func TestInMemoryRuleAttributes(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/suppress/proc_creation_win_net_user.yml")
+	require.NoError(t, err)
+	engine, err := singe.NewEngineFrom(singe.FromBytes("net_user.yml", data))
+	require.NoError(t, err)
+
+	// The suppression attribute is read from the loaded content rather than from disk
+	suppressor, err := suppress.NewSuppressor(suppress.Config{}, engine)
+	require.NoError(t, err)
+	kept := 0
+	for i := 0; i < 3; i++ {
+		msg, matched, err := engine.Evaluate(`{"Image": "C:\\Windows\\System32\\net.exe"}`, "json")
+		require.NoError(t, err)
+		require.True(t, matched)
+		if _, ok := suppressor.Apply(msg, time.Now()); ok {
+			kept++
+		}
+	}
+	assert.Equal(t, 2, kept)
+}
@@ -0,0 +1,241 @@
+package unit_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	singe "github.com/Adversary-Informed-Defense/singe/pkg/singe"
+	suppress "github.com/Adversary-Informed-Defense/singe/pkg/singe/suppress"
+	objx "github.com/stretchr/objx"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+// whoamiOnHost returns an event matched by the whoami rule on the host argument
+func whoamiOnHost(host string) string {
+	return `{"Image": "C:\\Windows\\System32\\whoami.exe", "host": {"name": "` + host + `"}}`
+}
+
+func TestSuppressor(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+	suppressor, err := suppress.NewSuppressor(suppress.Config{
+		Default: &suppress.Policy{Fields: []string{"host.name"}, Window: 10 * time.Minute},
+	}, engine)
+	require.NoError(t, err)
+
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		host   string
+		offset time.Duration
+		kept   bool
+	}{
+		{"DC1", 0, true},
+		{"DC1", time.Minute, false},
+		{"WS1", 2 * time.Minute, true},
+		{"DC1", 3 * time.Minute, false},
+		// The window of the first match has closed
+		{"DC1", 11 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		msg, matched, err := engine.Evaluate(whoamiOnHost(tt.host), "json")
+		require.NoError(t, err)
+		require.True(t, matched)
+		_, kept := suppressor.Apply(msg, start.Add(tt.offset))
+		assert.Equal(t, tt.kept, kept, "%s at %s", tt.host, tt.offset)
+	}
+
+	summaries := suppressor.Expire(start.Add(11 * time.Minute))
+	require.Len(t, summaries, 1)
+	summary := summaries[0]
+	assert.Equal(t, "e28a5a99-da44-436d-b7a0-2afc20a5f413", summary.Rule.ID)
+	assert.Equal(t, map[string]string{"host.name": "DC1"}, summary.Key)
+	assert.Equal(t, 3, summary.Count)
+	assert.Equal(t, 2, summary.Suppressed)
+	assert.Equal(t, start, summary.First)
+	assert.Equal(t, start.Add(3*time.Minute), summary.Last)
+
+	// Windows that suppressed nothing close without a summary
+	assert.Empty(t, suppressor.Flush())
+
+	encoded, err := json.Marshal(summary.Message())
+	require.NoError(t, err)
+	doc, err := objx.FromJSON(string(encoded))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, doc.Get("event.suppression.suppressed").Data())
+	assert.Equal(t, "DC1", doc.Get("event.suppression.key").ObjxMap()["host.name"])
+	assert.EqualValues(t, 1, doc.Get("sigma.count").Data())
+}
+
+func TestSuppressorRulePolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-suppress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The rule's own attribute allows two matches per window, the configuration overrides the whoami rule
+	config := []byte("rules:\n  e28a5a99-da44-436d-b7a0-2afc20a5f413:\n    window: 1h\n    limit: 3\n")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "suppress.yml"), config, 0644))
+	loaded, err := suppress.LoadConfig(filepath.Join(dir, "suppress.yml"))
+	require.NoError(t, err)
+
+	for _, ruleDir := range []string{"testdata/rules", "testdata/suppress"} {
+		engine := singe.CreateEngine(ruleDir)
+		suppressor, err := suppress.NewSuppressor(loaded, engine)
+		require.NoError(t, err)
+
+		event := `{"Image": "C:\\Windows\\System32\\net.exe", "host": {"name": "DC1"}}`
+		limit := 2
+		if ruleDir == "testdata/rules" {
+			event = whoamiOnHost("DC1")
+			limit = 3
+		}
+		kept := 0
+		for i := 0; i < 5; i++ {
+			msg, matched, err := engine.Evaluate(event, "json")
+			require.NoError(t, err)
+			require.True(t, matched)
+			if _, ok := suppressor.Apply(msg, time.Now()); ok {
+				kept++
+			}
+		}
+		assert.Equal(t, limit, kept, ruleDir)
+	}
+
+	_, err = suppress.NewSuppressor(suppress.Config{Default: &suppress.Policy{}}, singe.SigmaEngine{})
+	assert.Error(t, err)
+}
+
+func TestSuppressorRuleAttributeDocuments(t *testing.T) {
+	// The attribute of a rule without an ID applies under its generated ID
+	const noID = `title: Whoami Without ID
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        Image|endswith: '\whoami.exe'
+    condition: selection
+suppression:
+    window: 1h
+    limit: 2
+`
+	// Each rule of a collection has the attribute of its own document merged with the global one
+	const collection = `action: global
+title: Token Manipulation
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    condition: selection
+suppression:
+    window: 1h
+    limit: 3
+---
+id: 5b1f0c7e-2d3a-4e8b-9c6f-7a0d1e2f3b4c
+detection:
+    selection:
+        Image|endswith: '\incognito.exe'
+---
+id: 8e2a4b6c-1d3f-4a5b-8c7d-9e0f1a2b3c4d
+detection:
+    selection:
+        Image|endswith: '\tokenvator.exe'
+suppression:
+    window: 1h
+    limit: 1
+`
+	engine, err := singe.NewEngineFrom(singe.Sources(
+		singe.FromBytes("whoami.yml", []byte(noID)),
+		singe.FromBytes("token.yml", []byte(collection)),
+	), singe.FailOnError())
+	require.NoError(t, err)
+	suppressor, err := suppress.NewSuppressor(suppress.Config{}, engine)
+	require.NoError(t, err)
+
+	tests := []struct {
+		image string
+		limit int
+	}{
+		{"whoami.exe", 2},
+		{"incognito.exe", 3},
+		{"tokenvator.exe", 1},
+	}
+	for _, tt := range tests {
+		event := `{"Image": "C:\\Tools\\` + tt.image + `", "host": {"name": "DC1"}}`
+		kept := 0
+		for i := 0; i < 5; i++ {
+			msg, matched, err := engine.Evaluate(event, "json")
+			require.NoError(t, err)
+			require.True(t, matched, tt.image)
+			if _, ok := suppressor.Apply(msg, time.Now()); ok {
+				kept++
+			}
+		}
+		assert.Equal(t, tt.limit, kept, tt.image)
+	}
+}
+
+func TestSuppressorReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-suppress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestRule(t, dir, "proc_creation_win_whoami.yml", nil)
+
+	engine, err := singe.NewReloadableEngine(singe.FromDir(dir), nil)
+	require.NoError(t, err)
+	suppressor, err := suppress.NewSuppressor(suppress.Config{}, engine.Engine())
+	require.NoError(t, err)
+
+	// The suppression attribute of a rule added by a reload applies once the suppressor is reloaded
+	rule, err := ioutil.ReadFile("testdata/suppress/proc_creation_win_net_user.yml")
+	require.NoError(t, err)
+	writeTestRule(t, dir, "proc_creation_win_net_user.yml", rule)
+	_, err = engine.Reload()
+	require.NoError(t, err)
+	require.NoError(t, suppressor.Reload(engine.Engine()))
+
+	kept := 0
+	for i := 0; i < 5; i++ {
+		msg, matched, err := engine.Evaluate(`{"Image": "C:\\Windows\\System32\\net.exe", "host": {"name": "DC1"}}`, "json")
+		require.NoError(t, err)
+		require.True(t, matched)
+		if _, ok := suppressor.Apply(msg, time.Now()); ok {
+			kept++
+		}
+	}
+	assert.Equal(t, 2, kept)
+
+	// An invalid attribute keeps the previous ones
+	writeTestRule(t, dir, "proc_creation_win_net_user.yml", bytes.Replace(rule, []byte("limit: 2"), []byte("limit: -1"), 1))
+	_, err = engine.Reload()
+	require.NoError(t, err)
+	assert.Error(t, suppressor.Reload(engine.Engine()))
+}
+
+func TestSuppressSink(t *testing.T) {
+	engine := singe.CreateEngine("testdata/rules")
+	suppressor, err := suppress.NewSuppressor(suppress.Config{
+		Default: &suppress.Policy{Window: time.Hour},
+	}, engine)
+	require.NoError(t, err)
+
+	capture := &captureSink{}
+	sink := suppress.NewSink(capture, suppressor)
+	for i := 0; i < 3; i++ {
+		msg, _, err := engine.Evaluate(whoamiEvent, "json")
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(msg))
+	}
+	require.Len(t, capture.msgs, 1)
+
+	// Closing forwards the summary of the open window
+	require.NoError(t, sink.Close())
+	require.Len(t, capture.msgs, 2)
+	event, ok := capture.msgs[1].Event.Select("suppression.suppressed")
+	require.True(t, ok)
+	assert.Equal(t, 2, event)
+}
@@ -1,10 +1,16 @@
 package unit_tests
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	sigma "github.com/markuskont/go-sigma-rule-engine/pkg/sigma/v2"
+	objx "github.com/stretchr/objx"
 	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
 )
 
 func TestIsJSON(t *testing.T) {
@@ -163,3 +169,82 @@ func TestMapToVal(t *testing.T) {
 func TestEditRule(t *testing.T) {
 	t.Error("TODO")
 }
+
+func TestAddMappedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-mapped")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"proc_creation_win_whoami.yml":             "windows/process_creation/proc_creation_win_whoami.yml",
+		"proc_creation_win_powershell_encoded.yml": "windows/process_creation/proc_creation_win_powershell_encoded.yaml",
+	}
+	for src, dst := range files {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/rules", src))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, dst)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, dst), data, 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Rules"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "deprecated"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "deprecated", "broken.yml"), []byte("title: [broken"), 0644))
+
+	ruleset := &sigma.Ruleset{}
+	require.NoError(t, tools.AddMappedRules(ruleset, dir, objx.Map{"Image": "winlog.event_data.Image"}))
+	assert.Equal(t, []int{3, 2, 1, 0}, []int{ruleset.Total, ruleset.Ok, ruleset.Failed, ruleset.Unsupported})
+
+	event := sigma.DynamicMap{"winlog": map[string]interface{}{"event_data": map[string]interface{}{"Image": `C:\Windows\System32\whoami.exe`}}}
+	var matched []string
+	for _, tree := range ruleset.Rules {
+		assert.Equal(t, dir, filepath.Dir(filepath.Dir(filepath.Dir(tree.Rule.Path))))
+		if tree.Match(event) {
+			matched = append(matched, tree.Rule.ID)
+		}
+	}
+	assert.Equal(t, []string{"e28a5a99-da44-436d-b7a0-2afc20a5f413"}, matched)
+
+	assert.Error(t, tools.AddMappedRules(ruleset, filepath.Join(dir, "missing"), objx.Map{}))
+}
+
+func TestAddMappedRulesDetectionShapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "singe-mapped")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rule := `title: Whoami Selection List
+id: 3c6f1a2e-8b4d-4e7f-9a1c-5d2e0f3b4a6c
+logsource:
+    category: process_creation
+    product: windows
+detection:
+    selection:
+        - Image|endswith: '\whoami.exe'
+        - CommandLine|contains: 'whoami /all'
+    keywords: 'whoami'
+    timeframe: 1h
+    condition: selection
+level: high
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "whoami.yml"), []byte(rule), 0644))
+
+	// Scalars are kept and the fields of each selection map of a list are mapped
+	ruleset := &sigma.Ruleset{}
+	require.NoError(t, tools.AddMappedRules(ruleset, dir, objx.Map{
+		"Image":       "winlog.event_data.Image",
+		"CommandLine": "winlog.event_data.CommandLine",
+	}))
+	require.Equal(t, []int{1, 1, 0, 0}, []int{ruleset.Total, ruleset.Ok, ruleset.Failed, ruleset.Unsupported})
+	tests := []struct {
+		field   string
+		value   string
+		matched bool
+	}{
+		{"Image", `C:\Windows\System32\whoami.exe`, true},
+		{"CommandLine", "cmd.exe /c whoami /all", true},
+		{"ParentImage", `C:\Windows\System32\whoami.exe`, false},
+	}
+	for _, tt := range tests {
+		event := sigma.DynamicMap{"winlog": map[string]interface{}{"event_data": map[string]interface{}{tt.field: tt.value}}}
+		assert.Equal(t, tt.matched, ruleset.Rules[0].Match(event), tt.field)
+		unmapped := sigma.DynamicMap{tt.field: tt.value}
+		assert.False(t, ruleset.Rules[0].Match(unmapped), tt.field)
+	}
+}
@@ -0,0 +1,116 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	tools "github.com/Adversary-Informed-Defense/singe/pkg/singe/tools"
+	validate "github.com/Adversary-Informed-Defense/singe/pkg/singe/validate"
+	objx "github.com/stretchr/objx"
+	assert "github.com/stretchr/testify/assert"
+	require "github.com/stretchr/testify/require"
+)
+
+// validRule is the header of a rule without findings, completed by the detection of each test
+const validRule = `title: Whoami Execution
+id: e28a5a99-da44-436d-b7a0-2afc20a5f413
+status: experimental
+level: high
+tags:
+    - attack.discovery
+    - attack.t1033
+logsource:
+    category: process_creation
+    product: windows
+`
+
+func TestValidate(t *testing.T) {
+	whoami, err := ioutil.ReadFile("testdata/rules/proc_creation_win_whoami.yml")
+	require.NoError(t, err)
+	detection := "detection:\n    selection:\n        Image|endswith: '\\whoami.exe'\n    condition: selection\n"
+	tests := []struct {
+		name     string
+		rule     string
+		check    string
+		severity validate.Severity
+		message  string
+	}{
+		{"valid", validRule + detection, "", validate.ErrorSeverity, ""},
+		{"syntax", "title: [broken", validate.SyntaxCheck, validate.ErrorSeverity, "did not find expected"},
+		{"title", "id: e28a5a99-da44-436d-b7a0-2afc20a5f413\nstatus: test\nlevel: low\nlogsource:\n    product: windows\n" + detection,
+			validate.RequiredCheck, validate.ErrorSeverity, "missing title"},
+		{"logsource", "title: No Logsource\nid: e28a5a99-da44-436d-b7a0-2afc20a5f413\nstatus: test\nlevel: low\n" + detection,
+			validate.RequiredCheck, validate.ErrorSeverity, "missing logsource"},
+		{"detection", validRule, validate.RequiredCheck, validate.ErrorSeverity, "missing detection"},
+		{"condition", validRule + "detection:\n    selection:\n        Image: whoami.exe\n",
+			validate.RequiredCheck, validate.ErrorSeverity, "missing condition"},
+		{"missing id", "title: No ID\nstatus: test\nlevel: low\nlogsource:\n    product: windows\n" + detection,
+			validate.IDCheck, validate.WarningSeverity, "missing id"},
+		{"invalid id", "title: Bad ID\nid: rule-1\nstatus: test\nlevel: low\nlogsource:\n    product: windows\n" + detection,
+			validate.IDCheck, validate.ErrorSeverity, `"rule-1" is not a UUID`},
+		{"level", "title: Bad Level\nid: e28a5a99-da44-436d-b7a0-2afc20a5f413\nstatus: test\nlevel: severe\nlogsource:\n    product: windows\n" + detection,
+			validate.LevelCheck, validate.ErrorSeverity, `unknown level "severe"`},
+		{"status", "title: Bad Status\nid: e28a5a99-da44-436d-b7a0-2afc20a5f413\nstatus: production\nlevel: low\nlogsource:\n    product: windows\n" + detection,
+			validate.StatusCheck, validate.ErrorSeverity, `unknown status "production"`},
+		{"tag", "title: Bad Tag\nid: e28a5a99-da44-436d-b7a0-2afc20a5f413\nstatus: test\nlevel: low\ntags:\n    - Attack.T1033\nlogsource:\n    product: windows\n" + detection,
+			validate.TagCheck, validate.WarningSeverity, `"Attack.T1033"`},
+		{"undefined identifier", validRule + "detection:\n    selection:\n        Image: whoami.exe\n    condition: selection and not filter\n",
+			validate.ConditionCheck, validate.ErrorSeverity, `undefined identifier "filter"`},
+		{"unused selection", validRule + "detection:\n    selection:\n        Image: whoami.exe\n    filter:\n        User: SYSTEM\n    condition: selection\n",
+			validate.UnusedCheck, validate.WarningSeverity, `selection "filter"`},
+		{"modifier", validRule + "detection:\n    selection:\n        Image|endwith: whoami.exe\n    condition: selection\n",
+			validate.ModifierCheck, validate.ErrorSeverity, `unknown modifier "endwith"`},
+		{"wildcard identifiers", validRule + "detection:\n    selection_img:\n        Image: whoami.exe\n    selection_cli:\n        - CommandLine|contains|all:\n            - whoami\n            - /priv\n    condition: 1 of selection_*\n",
+			"", validate.ErrorSeverity, ""},
+		{"them", validRule + "detection:\n    keywords:\n        - whoami\n    selection:\n        Image: whoami.exe\n    condition: all of them\n",
+			"", validate.ErrorSeverity, ""},
+		{"aggregation", validRule + "detection:\n    selection:\n        Image: whoami.exe\n    timeframe: 5m\n    condition: selection | count() by User > 5\n",
+			"", validate.ErrorSeverity, ""},
+	}
+	for _, tt := range tests {
+		findings := validate.ValidateRule("rule.yml", []byte(tt.rule), validate.Options{})
+		if tt.check == "" {
+			assert.Empty(t, findings, tt.name)
+			continue
+		}
+		if assert.Len(t, findings, 1, tt.name) {
+			assert.Equal(t, tt.check, findings[0].Check, tt.name)
+			assert.Equal(t, tt.severity, findings[0].Severity, tt.name)
+			assert.Contains(t, findings[0].Message, tt.message, tt.name)
+			assert.Equal(t, "rule.yml", findings[0].Path, tt.name)
+		}
+	}
+
+	// Duplicate IDs are reported across files
+	findings := validate.Validate([]tools.RuleFile{tools.BytesFile("a.yml", whoami), tools.BytesFile("b.yml", whoami)}, validate.Options{})
+	require.Len(t, findings, 1)
+	assert.Equal(t, validate.DuplicateCheck, findings[0].Check)
+	assert.Equal(t, "b.yml", findings[0].Path)
+}
+
+func TestValidateMapping(t *testing.T) {
+	rule := validRule + "detection:\n    selection:\n        Image: whoami.exe\n        User: SYSTEM\n    condition: selection\n"
+	findings := validate.ValidateRule("rule.yml", []byte(rule), validate.Options{Mapping: objx.Map{"Image": "winlog.event_data.Image"}})
+	require.Len(t, findings, 1)
+	assert.Equal(t, validate.FieldCheck, findings[0].Check)
+	assert.Contains(t, findings[0].Message, `field "User"`)
+
+	encoded, err := json.Marshal(findings[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path": "rule.yml", "id": "e28a5a99-da44-436d-b7a0-2afc20a5f413", "check": "field", "severity": "warning",
+		"message": "field \"User\" of selection \"selection\" is not in the field mapping"}`, string(encoded))
+}
+
+func TestValidateCollection(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/collections/proc_creation_win_discovery.yml")
+	require.NoError(t, err)
+	findings := validate.ValidateRule("collection.yml", data, validate.Options{})
+	assert.Empty(t, findings)
+
+	// Findings of a collection's rules are located by their part
+	findings = validate.ValidateRule("collection.yml", append(data, []byte("---\naction: repeat\nlevel: severe\n")...), validate.Options{})
+	require.Len(t, findings, 1)
+	assert.Equal(t, 5, findings[0].Part)
+	assert.Equal(t, validate.LevelCheck, findings[0].Check)
+}